@@ -0,0 +1,140 @@
+package buildinfo
+
+import (
+	"ModCreator/file"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ModuleName is what scripts require to get the BUILD_INFO table.
+	ModuleName = "generated/buildinfo"
+	// PinCommit pins the build time to the time of the current commit.
+	PinCommit = "commit"
+)
+
+// Info describes what a build was made from.
+type Info struct {
+	Commit   string
+	Describe string
+	Dirty    bool
+	Time     time.Time
+}
+
+// Now is the Info of a build outside any git repository, with only its time
+// set: pin is as for Read, except that PinCommit means now.
+func Now(pin string) (Info, error) {
+	i := Info{Time: time.Now().UTC()}
+	if env := os.Getenv("SOURCE_DATE_EPOCH"); pin == "" && env != "" {
+		pin = env
+	}
+	if pin != "" && pin != PinCommit {
+		t, err := parseTime(pin)
+		if err != nil {
+			return i, err
+		}
+		i.Time = t
+	}
+	return i, nil
+}
+
+// Read asks git about the repository containing dir. pin sets the build time:
+// empty means now (or $SOURCE_DATE_EPOCH if set), PinCommit means the commit
+// time, otherwise it is RFC3339 or seconds since the epoch. When dir isn't in a
+// git repository, or git isn't installed, the returned Info still has its time
+// set.
+func Read(dir, pin string) (Info, error) {
+	i, err := Now(pin)
+	if err != nil {
+		return i, err
+	}
+	if env := os.Getenv("SOURCE_DATE_EPOCH"); pin == "" && env != "" {
+		pin = env
+	}
+
+	if err := inRepository(dir); err != nil {
+		return i, err
+	}
+	if err := readRepository(&i, dir, pin); err != nil {
+		return i, fmt.Errorf("reading the git repository : %w", err)
+	}
+	return i, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("build time %s is neither RFC3339 nor seconds since the epoch", s)
+	}
+	return t.UTC(), nil
+}
+
+// ShortCommit is the abbreviated commit hash.
+func (i Info) ShortCommit() string {
+	if len(i.Commit) > 7 {
+		return i.Commit[:7]
+	}
+	return i.Commit
+}
+
+// Version is the describe name, marked if the work tree had changes.
+func (i Info) Version() string {
+	v := i.Describe
+	if v == "" {
+		v = "unknown"
+	}
+	if i.Dirty {
+		v += "-dirty"
+	}
+	return v
+}
+
+// Placeholders maps each {{name}} which Substitute replaces to its value.
+func (i Info) Placeholders() map[string]string {
+	dirty := ""
+	if i.Dirty {
+		dirty = "dirty"
+	}
+	return map[string]string{
+		"{{commit}}":       i.Commit,
+		"{{short_commit}}": i.ShortCommit(),
+		"{{describe}}":     i.Describe,
+		"{{dirty}}":        dirty,
+		"{{version}}":      i.Version(),
+		"{{build_time}}":   i.Time.Format(time.RFC3339),
+		"{{build_epoch}}":  strconv.FormatInt(i.Time.Unix(), 10),
+	}
+}
+
+// Substitute fills in any build placeholders in s.
+func (i Info) Substitute(s string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	for k, v := range i.Placeholders() {
+		s = strings.ReplaceAll(s, k, v)
+	}
+	return s
+}
+
+// Module generates lua defining a global BUILD_INFO table.
+func (i Info) Module() string {
+	var sb strings.Builder
+	sb.WriteString("-- Generated by ModCreator at build time. Do not edit.\n")
+	sb.WriteString("BUILD_INFO = {\n")
+	fmt.Fprintf(&sb, "  commit = %s,\n", file.LuaString(i.Commit))
+	fmt.Fprintf(&sb, "  short_commit = %s,\n", file.LuaString(i.ShortCommit()))
+	fmt.Fprintf(&sb, "  describe = %s,\n", file.LuaString(i.Describe))
+	fmt.Fprintf(&sb, "  dirty = %v,\n", i.Dirty)
+	fmt.Fprintf(&sb, "  version = %s,\n", file.LuaString(i.Version()))
+	fmt.Fprintf(&sb, "  build_time = %s,\n", file.LuaString(i.Time.Format(time.RFC3339)))
+	fmt.Fprintf(&sb, "  build_epoch = %v,\n", i.Time.Unix())
+	sb.WriteString("}")
+	return sb.String()
+}
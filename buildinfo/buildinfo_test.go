@@ -0,0 +1,89 @@
+package buildinfo
+
+import (
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(cmd.Env, "GIT_AUTHOR_NAME=a", "GIT_AUTHOR_EMAIL=a@b", "GIT_COMMITTER_NAME=a", "GIT_COMMITTER_EMAIL=a@b", "GIT_COMMITTER_DATE=1600000000 +0000", "HOME="+dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v : %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestRead(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	write := func(content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git(t, dir, "init", "-q")
+	write("{}")
+	git(t, dir, "add", "config.json")
+	git(t, dir, "commit", "-qm", "first")
+	git(t, dir, "tag", "-a", "v1.0", "-m", "v1.0")
+	write(`{"a": 1}`)
+	git(t, dir, "commit", "-qam", "second")
+	// pack everything so objects are read from packfiles.
+	git(t, dir, "gc", "-q")
+
+	i, err := Read(dir, PinCommit)
+	if err != nil {
+		t.Fatalf("Read() : %v", err)
+	}
+	if want := git(t, dir, "rev-parse", "HEAD"); i.Commit != want {
+		t.Errorf("want commit %s got %s", want, i.Commit)
+	}
+	if want := git(t, dir, "describe", "--tags"); i.Describe != want {
+		t.Errorf("want describe %s got %s", want, i.Describe)
+	}
+	if i.Dirty {
+		t.Errorf("want clean work tree")
+	}
+	if !i.Time.Equal(time.Unix(1600000000, 0)) {
+		t.Errorf("want commit time, got %v", i.Time)
+	}
+
+	write(`{"a": 2}`)
+	if i, err = Read(dir, "1700000000"); err != nil {
+		t.Fatalf("Read() : %v", err)
+	}
+	if !i.Dirty {
+		t.Errorf("want dirty work tree")
+	}
+	if got := i.Substitute("{{version}} built {{build_time}}"); got != i.Describe+"-dirty built 2023-11-14T22:13:20Z" {
+		t.Errorf("Substitute() got <%s>", got)
+	}
+}
+
+func TestReadWithoutRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	if _, err := Read(dir, "1700000000"); !errors.Is(err, ErrNoRepository) {
+		t.Errorf("want ErrNoRepository, got %v", err)
+	}
+	t.Setenv("PATH", "")
+	i, err := Read(dir, "1700000000")
+	if !errors.Is(err, ErrNoGit) {
+		t.Errorf("want ErrNoGit, got %v", err)
+	}
+	if i.Time.Unix() != 1700000000 || i.Commit != "" {
+		t.Errorf("want only the time set, got %+v", i)
+	}
+}
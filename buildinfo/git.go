@@ -0,0 +1,86 @@
+package buildinfo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+var (
+	// ErrNoRepository is returned when the project isn't inside a git
+	// repository.
+	ErrNoRepository = errors.New("no git repository found")
+	// ErrNoGit is returned when git isn't installed, so the repository can't
+	// be read.
+	ErrNoGit = errors.New("git is not installed")
+)
+
+// dirtySuffix is what git describe --dirty appends for a changed work tree.
+const dirtySuffix = "-dirty"
+
+// gitError is git exiting with an error, along with what it printed.
+type gitError struct {
+	args   []string
+	err    error
+	stderr string
+}
+
+func (e *gitError) Error() string {
+	return fmt.Sprintf("git %s : %v : %s", strings.Join(e.args, " "), e.err, e.stderr)
+}
+
+// runGit runs git in dir, returning its output without the trailing newline.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", ErrNoGit
+	}
+	if err != nil {
+		return "", &gitError{args: args, err: err, stderr: strings.TrimSpace(stderr.String())}
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// inRepository checks dir is inside a git work tree.
+func inRepository(dir string) error {
+	_, err := runGit(dir, "rev-parse", "--is-inside-work-tree")
+	var gerr *gitError
+	if errors.As(err, &gerr) && strings.Contains(gerr.stderr, "not a git repository") {
+		return ErrNoRepository
+	}
+	return err
+}
+
+// readRepository fills in i from the repository containing dir, whose HEAD is
+// a commit.
+func readRepository(i *Info, dir, pin string) error {
+	head, err := runGit(dir, "rev-parse", "--verify", "-q", "HEAD")
+	if err != nil {
+		// a repository without any commits yet.
+		i.Dirty = true
+		return nil
+	}
+	i.Commit = head
+	if pin == PinCommit {
+		secs, err := runGit(dir, "log", "-1", "--format=%ct", head)
+		if err != nil {
+			return err
+		}
+		if i.Time, err = parseTime(secs); err != nil {
+			return fmt.Errorf("commit time of %s : %v", head, err)
+		}
+	}
+	describe, err := runGit(dir, "describe", "--tags", "--always", "--dirty="+dirtySuffix)
+	if err != nil {
+		return err
+	}
+	i.Describe = strings.TrimSuffix(describe, dirtySuffix)
+	i.Dirty = i.Describe != describe
+	return nil
+}
@@ -1,10 +1,10 @@
 package main
 
 import (
-	file "ModCreator/file"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -14,12 +14,25 @@ var (
 	altModfile = flag.String("altmodfile", "", "where to read second mod from when comparing.")
 )
 
+// readRaw reads a json file without objects.
+func readRaw(filename string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile(%s): %v", filename, err)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal(%s): %v", filename, err)
+	}
+	return v, nil
+}
+
 func compareDelta(t *testing.T, filea, fileb string) error {
-	a, err := file.ReadRawFile(filea)
+	a, err := readRaw(filea)
 	if err != nil {
 		return err
 	}
-	b, err := file.ReadRawFile(fileb)
+	b, err := readRaw(fileb)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,309 @@
+// Package deps builds the graph of which lua modules each script in a config
+// directory requires, to show where the size of a built script comes from.
+package deps
+
+import (
+	"ModCreator/objects"
+	"ModCreator/ttsjson"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	globalName = "Global"
+	luaSuffix  = ".ttslua"
+	testSuffix = "_test.ttslua"
+	pathExt    = "_path"
+)
+
+// Resolver reads scripts and resolves their requires. *file.LuaOps is one.
+type Resolver interface {
+	FileRequires(filename string) ([]string, int, error)
+	ScriptRequires(script string) ([]string, int, error)
+	DataSize(filename string) (int, error)
+}
+
+// Tree describes the layout of a config directory.
+type Tree struct {
+	// FS is the config directory.
+	FS            fs.FS
+	TextSubdir    string
+	ObjectsSubdir string
+	// Modules are generated at build time, so they are never unused.
+	Modules []string
+}
+
+// Entry is a script TTS runs: Global's, or an object's.
+type Entry struct {
+	// ID is "Global" or the object's GUID.
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	// Source is the file, relative to the config directory, the script is
+	// set in.
+	Source string `json:"source"`
+	// Size is the length of the built script.
+	Size     int      `json:"size"`
+	Requires []string `json:"requires"`
+}
+
+// Module is a file under the text directory which some script requires, or
+// which could be required.
+type Module struct {
+	File string `json:"file"`
+	// Size is the length of the module once its own requires are expanded,
+	// or of the lua table a data file becomes.
+	Size     int      `json:"size"`
+	Data     bool     `json:"data,omitempty"`
+	Requires []string `json:"requires"`
+	// UsedBy lists the entries which include this module, directly or not.
+	UsedBy []string `json:"used_by"`
+	Unused bool     `json:"unused,omitempty"`
+	Shared bool     `json:"shared,omitempty"`
+}
+
+// Graph is every entry, and every module they require.
+type Graph struct {
+	Entries []*Entry  `json:"entries"`
+	Modules []*Module `json:"modules"`
+}
+
+type builder struct {
+	t       Tree
+	r       Resolver
+	g       *Graph
+	modules map[string]*Module
+	ids     map[string]bool
+}
+
+// Build resolves the requires of Global and every object script in t. Modules
+// used by at least sharedBy entries are marked Shared.
+func Build(t Tree, r Resolver, sharedBy int) (*Graph, error) {
+	b := &builder{t: t, r: r, g: &Graph{Entries: []*Entry{}, Modules: []*Module{}}, modules: map[string]*Module{}, ids: map[string]bool{}}
+	if err := b.config(); err != nil {
+		return nil, err
+	}
+	if err := b.objects(); err != nil {
+		return nil, err
+	}
+	for _, e := range b.g.Entries {
+		seen := map[string]bool{}
+		if err := b.reach(e.ID, e.Requires, seen); err != nil {
+			return nil, fmt.Errorf("%s (%s) : %v", e.ID, e.Source, err)
+		}
+	}
+	if err := b.unused(); err != nil {
+		return nil, err
+	}
+
+	for _, m := range b.modules {
+		m.Shared = len(m.UsedBy) >= sharedBy
+		b.g.Modules = append(b.g.Modules, m)
+	}
+	sort.Slice(b.g.Modules, func(i, k int) bool { return b.g.Modules[i].File < b.g.Modules[k].File })
+	return b.g, nil
+}
+
+// entry adds the script of o, set in source, if it has one.
+func (b *builder) entry(id, label, source string, o *ttsjson.Object) error {
+	e := &Entry{ID: id, Label: label, Source: source, Requires: []string{}}
+	if name, ok := o.String("LuaScript" + pathExt); ok {
+		_, size, err := b.r.FileRequires(name)
+		if err != nil {
+			return fmt.Errorf("%s : %v", source, err)
+		}
+		e.Size, e.Requires = size, []string{name}
+	} else if script, ok := o.String("LuaScript"); ok && script != "" {
+		reqs, size, err := b.r.ScriptRequires(script)
+		if err != nil {
+			return fmt.Errorf("%s : %v", source, err)
+		}
+		e.Size, e.Requires = size, reqs
+	} else {
+		return nil
+	}
+	for n := 2; b.ids[e.ID]; n++ {
+		e.ID = fmt.Sprintf("%s_%v", id, n)
+	}
+	b.ids[e.ID] = true
+	b.g.Entries = append(b.g.Entries, e)
+	return nil
+}
+
+func (b *builder) config() error {
+	raw, err := fs.ReadFile(b.t.FS, "config.json")
+	if err != nil {
+		return fmt.Errorf("fs.ReadFile(config.json) : %v", err)
+	}
+	c, err := ttsjson.UnmarshalObject(raw)
+	if err != nil {
+		return fmt.Errorf("config.json : %v", err)
+	}
+	return b.entry(globalName, globalName, "config.json", c)
+}
+
+func (b *builder) objects() error {
+	err := fs.WalkDir(b.t.FS, path.Clean(b.t.ObjectsSubdir), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, ".json") {
+			return nil
+		}
+		raw, err := fs.ReadFile(b.t.FS, p)
+		if err != nil {
+			return err
+		}
+		o, err := ttsjson.UnmarshalObject(raw)
+		if err != nil {
+			return fmt.Errorf("%s : %v", p, err)
+		}
+		var walkErr error
+		objects.Walk([]interface{}{o}, func(obj *ttsjson.Object) {
+			guid, _ := obj.String("GUID")
+			label, _ := obj.String("Nickname")
+			if label == "" {
+				label, _ = obj.String("Name")
+			}
+			if err := b.entry(guid, label, p, obj); err != nil && walkErr == nil {
+				walkErr = err
+			}
+		})
+		return walkErr
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// reach marks every module in reqs, and everything they require, as used by
+// the entry id.
+func (b *builder) reach(id string, reqs []string, seen map[string]bool) error {
+	for _, name := range reqs {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		m, err := b.module(name)
+		if err != nil {
+			return err
+		}
+		m.UsedBy = append(m.UsedBy, id)
+		if err := b.reach(id, m.Requires, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *builder) module(name string) (*Module, error) {
+	if m, ok := b.modules[name]; ok {
+		return m, nil
+	}
+	m := &Module{File: name, Requires: []string{}, UsedBy: []string{}}
+	if strings.HasSuffix(name, luaSuffix) {
+		reqs, size, err := b.r.FileRequires(name)
+		if err != nil {
+			return nil, fmt.Errorf("require(%s) : %v", strings.TrimSuffix(name, luaSuffix), err)
+		}
+		m.Size, m.Requires = size, reqs
+	} else {
+		size, err := b.r.DataSize(name)
+		if err != nil {
+			return nil, err
+		}
+		m.Size, m.Data = size, true
+	}
+	b.modules[name] = m
+	return m, nil
+}
+
+// unused adds every lua file no entry requires, other than tests and
+// generated modules.
+func (b *builder) unused() error {
+	generated := map[string]bool{}
+	for _, m := range b.t.Modules {
+		generated[m+luaSuffix] = true
+	}
+	root := path.Clean(b.t.TextSubdir)
+	err := fs.WalkDir(b.t.FS, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, luaSuffix) || strings.HasSuffix(p, testSuffix) {
+			return nil
+		}
+		name := p
+		if root != "." {
+			name = strings.TrimPrefix(p, root+"/")
+		}
+		if _, ok := b.modules[name]; ok || generated[name] {
+			return nil
+		}
+		reqs, size, err := b.r.FileRequires(name)
+		if err != nil {
+			// an unused file needn't build.
+			reqs = []string{}
+		}
+		b.modules[name] = &Module{File: name, Size: size, Requires: reqs, UsedBy: []string{}, Unused: true}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// DOT writes the graph in graphviz format. Entries are drawn as octagons,
+// shared modules are filled and unused modules are dashed.
+func (g *Graph) DOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph deps {\n  rankdir=LR;\n  node [shape=box];\n")
+	for _, e := range g.Entries {
+		label := e.ID
+		if e.Label != "" && e.Label != e.ID {
+			label = e.Label + " " + e.ID
+		}
+		fmt.Fprintf(&sb, "  %q [label=%q, shape=octagon];\n", e.ID, label+"\n"+Size(e.Size))
+	}
+	for _, m := range g.Modules {
+		label := m.File + "\n" + Size(m.Size)
+		attrs := ""
+		switch {
+		case m.Unused:
+			label += "\nunused"
+			attrs = ", style=dashed"
+		case m.Shared:
+			label += fmt.Sprintf("\nused by %v", len(m.UsedBy))
+			attrs = ", style=filled, fillcolor=orange"
+		}
+		if m.Data {
+			attrs += ", shape=note"
+		}
+		fmt.Fprintf(&sb, "  %q [label=%q%s];\n", m.File, label, attrs)
+	}
+	for _, e := range g.Entries {
+		for _, r := range e.Requires {
+			fmt.Fprintf(&sb, "  %q -> %q;\n", e.ID, r)
+		}
+	}
+	for _, m := range g.Modules {
+		for _, r := range m.Requires {
+			fmt.Fprintf(&sb, "  %q -> %q;\n", m.File, r)
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Size formats a number of bytes for people.
+func Size(n int) string {
+	if n < 1024 {
+		return fmt.Sprintf("%v B", n)
+	}
+	return fmt.Sprintf("%.1f KB", float64(n)/1024)
+}
@@ -0,0 +1,80 @@
+package deps
+
+import (
+	"ModCreator/file"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestBuild(t *testing.T) {
+	files := map[string]string{
+		"config.json":            `{"LuaScript_path": "Global.ttslua"}`,
+		"src/Global.ttslua":      "require(\"lib/util\")\nrequire(\"lib/ui\")\n",
+		"src/lib/util.ttslua":    "local util = {}\n",
+		"src/lib/ui.ttslua":      "require(\"lib/util\")\nlocal cards = require(\"data/cards.json\")\n",
+		"src/lib/old.ttslua":     "-- nobody needs me\n",
+		"src/lib/ui_test.ttslua": "require(\"lib/ui\")\n",
+		"src/data/cards.json":    `[1, 2]`,
+		"src/Card.ttslua":        "require(\"lib/util\")\n",
+		"objects/a.json":         `{"GUID": "aaa111", "Name": "Card", "LuaScript_path": "Card.ttslua"}`,
+		"objects/b.json":         `{"GUID": "bbb222", "Name": "Card", "Nickname": "Two", "LuaScript": "require(\"lib/util\")\n", "States": {"2": {"GUID": "ccc333", "Name": "Card"}}}`,
+	}
+	m := fstest.MapFS{}
+	for name, content := range files {
+		m[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	src, err := fs.Sub(m, "src")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := Build(Tree{FS: m, TextSubdir: "src", ObjectsSubdir: "objects"}, file.NewLuaOpsFS(src), 3)
+	if err != nil {
+		t.Fatalf("Build() : %v", err)
+	}
+
+	ids := []string{}
+	for _, e := range g.Entries {
+		ids = append(ids, e.ID)
+	}
+	if got := strings.Join(ids, ","); got != "Global,aaa111,bbb222" {
+		t.Errorf("want entries Global,aaa111,bbb222 got %s", got)
+	}
+	modules := map[string]*Module{}
+	for _, m := range g.Modules {
+		modules[m.File] = m
+	}
+	if len(modules) != 6 {
+		t.Errorf("want 6 modules, got %v", len(g.Modules))
+	}
+	util := modules["lib/util.ttslua"]
+	if !util.Shared || strings.Join(util.UsedBy, ",") != "Global,aaa111,bbb222" {
+		t.Errorf("want lib/util shared by every entry, got %+v", util)
+	}
+	if util.Size != len("local util = {}\n") {
+		t.Errorf("want lib/util size %v got %v", len("local util = {}\n"), util.Size)
+	}
+	if ui := modules["lib/ui.ttslua"]; ui.Shared || ui.Size <= util.Size {
+		t.Errorf("want lib/ui unshared and bigger than lib/util, got %+v", ui)
+	}
+	if cards := modules["data/cards.json"]; !cards.Data || cards.Size != len("{1, 2}") {
+		t.Errorf("want data/cards.json as data of size 6, got %+v", cards)
+	}
+	if !modules["lib/old.ttslua"].Unused || modules["Global.ttslua"].Unused {
+		t.Errorf("want only lib/old unused")
+	}
+
+	dot := g.DOT()
+	for _, want := range []string{
+		`"Global" -> "Global.ttslua";`,
+		`"lib/ui.ttslua" -> "data/cards.json";`,
+		`"bbb222" -> "lib/util.ttslua";`,
+		`"lib/old.ttslua" [label="lib/old.ttslua\n19 B\nunused", style=dashed];`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("want %s in <%s>", want, dot)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package file
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// like: local cards = require("data/cards.json")
+	dataRequire = regexp.MustCompile(`require\(\\?"([a-zA-Z0-9/_.-]+\.(json|csv))\\?"\)`)
+	identifier  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	luaKeywords = map[string]bool{
+		"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true,
+		"false": true, "for": true, "function": true, "goto": true, "if": true, "in": true,
+		"local": true, "nil": true, "not": true, "or": true, "repeat": true, "return": true,
+		"then": true, "true": true, "until": true, "while": true,
+	}
+)
+
+// embedData replaces requires of .json and .csv files with a lua table
+// constructor holding their data. The constructor stays on one line so that
+// no lines of the script move.
+func (l *LuaOps) embedData(script string) (string, error) {
+	var embedErr error
+	replaced := dataRequire.ReplaceAllStringFunc(script, func(req string) string {
+		m := dataRequire.FindStringSubmatch(req)
+		b, err := l.readFileToBytes(path.Join(l.basepath, m[1]))
+		if err != nil {
+			embedErr = fmt.Errorf("embedding %s : %v", m[1], err)
+			return req
+		}
+		var table string
+		if m[2] == "csv" {
+			table, err = CSVToLua(b)
+		} else {
+			table, err = JSONToLua(b)
+		}
+		if err != nil {
+			embedErr = fmt.Errorf("embedding %s : %v", m[1], err)
+			return req
+		}
+		return table
+	})
+	return replaced, embedErr
+}
+
+// JSONToLua converts a json document into an equivalent lua expression.
+func JSONToLua(b []byte) (string, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return "", fmt.Errorf("json decode : %v", err)
+	}
+	var sb strings.Builder
+	if err := writeLua(&sb, v, "$"); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// CSVToLua converts a csv document with a header row into a lua array with a
+// table per row, keyed by the header. Every value is a string.
+func CSVToLua(b []byte) (string, error) {
+	records, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("csv decode : %v", err)
+	}
+	if len(records) == 0 {
+		return "{}", nil
+	}
+	header := records[0]
+	rows := []interface{}{}
+	for _, rec := range records[1:] {
+		row := map[string]interface{}{}
+		for i, v := range rec {
+			if i < len(header) {
+				row[header[i]] = v
+			}
+		}
+		rows = append(rows, row)
+	}
+	var sb strings.Builder
+	err = writeLua(&sb, rows, "$")
+	return sb.String(), err
+}
+
+// writeLua writes v, found at where in the document, as lua. A null in an
+// array is an error, since nil would end the lua array there: # and ipairs
+// would stop short of the elements after it.
+func writeLua(sb *strings.Builder, v interface{}, where string) error {
+	switch val := v.(type) {
+	case nil:
+		sb.WriteString("nil")
+	case bool:
+		fmt.Fprint(sb, val)
+	case json.Number:
+		sb.WriteString(val.String())
+	case string:
+		sb.WriteString(LuaString(val))
+	case []interface{}:
+		sb.WriteString("{")
+		for i, e := range val {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			at := fmt.Sprintf("%s[%v]", where, i)
+			if e == nil {
+				return fmt.Errorf("null at %s : lua arrays can't hold nil", at)
+			}
+			if err := writeLua(sb, e, at); err != nil {
+				return err
+			}
+		}
+		sb.WriteString("}")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		sb.WriteString("{")
+		for i, k := range keys {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			if identifier.MatchString(k) && !luaKeywords[k] {
+				sb.WriteString(k)
+			} else {
+				sb.WriteString("[" + LuaString(k) + "]")
+			}
+			sb.WriteString(" = ")
+			if err := writeLua(sb, val[k], where+"."+k); err != nil {
+				return err
+			}
+		}
+		sb.WriteString("}")
+	}
+	return nil
+}
+
+// LuaString quotes s as a lua string literal.
+func LuaString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				// a decimal escape must not run into a following digit.
+				fmt.Fprintf(&sb, `\%03d`, c)
+				continue
+			}
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,55 @@
+package file
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmbedData(t *testing.T) {
+	ff := &fakeFiles{
+		fs: map[string][]byte{
+			"src/base.ttslua":     []byte("local cards = require(\"data/cards.json\")\nlocal rows = require(\"data/rows.csv\")"),
+			"src/data/cards.json": []byte(`{"list": [1, 2.50, false], "none": null, "end": "quote \" and\nnewline", "ok": true}`),
+			"src/data/rows.csv":   []byte("id,name\n1,Ace\n2,\"King, of \"\"Hearts\"\"\"\n"),
+		},
+	}
+	l := &LuaOps{
+		basepath:        "src",
+		readFileToBytes: ff.read,
+	}
+
+	got, err := l.EncodeFromFile("base.ttslua")
+	if err != nil {
+		t.Fatalf("encode error %v", err)
+	}
+	want := `local cards = {["end"] = "quote \" and\nnewline", list = {1, 2.50, false}, none = nil, ok = true}
+local rows = {{id = "1", name = "Ace"}, {id = "2", name = "King, of \"Hearts\""}}`
+	if want != got {
+		t.Errorf("want <%s> got <%s>", want, got)
+	}
+}
+
+func TestEmbedNull(t *testing.T) {
+	ff := &fakeFiles{
+		fs: map[string][]byte{
+			"src/base.ttslua":     []byte(`local cards = require("data/cards.json")`),
+			"src/data/cards.json": []byte(`{"list": [1, null, 3]}`),
+		},
+	}
+	l := &LuaOps{
+		basepath:        "src",
+		readFileToBytes: ff.read,
+	}
+	_, err := l.EncodeFromFile("base.ttslua")
+	if err == nil || !strings.Contains(err.Error(), "data/cards.json") || !strings.Contains(err.Error(), "$.list[1]") {
+		t.Errorf("want an error naming the file and the null, got %v", err)
+	}
+}
+
+func TestLuaString(t *testing.T) {
+	got := LuaString("a\x01" + "2\\")
+	want := `"a\0012\\"`
+	if want != got {
+		t.Errorf("want <%s> got <%s>", want, got)
+	}
+}
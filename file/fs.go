@@ -0,0 +1,294 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing/fstest"
+	"time"
+)
+
+// WriteFS is a file system which can be written to as well as read. Names are
+// slash separated and relative, as for fs.FS.
+type WriteFS interface {
+	fs.FS
+	// WriteFile writes data to the file name, creating or truncating it.
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	// MkdirAll creates the directory name and any parents it needs.
+	MkdirAll(name string, perm fs.FileMode) error
+	// Remove deletes the file or empty directory name.
+	Remove(name string) error
+	// Rename moves the file or directory oldname to newname, replacing a
+	// file already there.
+	Rename(oldname, newname string) error
+}
+
+// ErrReadOnly is returned when writing to a file system which isn't a
+// WriteFS.
+var ErrReadOnly = errors.New("file system is read only")
+
+// DirFS is the directory dir on disk, as a WriteFS. An empty dir is the
+// current directory.
+func DirFS(dir string) WriteFS {
+	if dir == "" {
+		dir = "."
+	}
+	return dirFS{dir: dir, FS: os.DirFS(dir)}
+}
+
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+func (d dirFS) path(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(d.dir, filepath.FromSlash(name)), nil
+}
+
+func (d dirFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	p, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, perm)
+}
+
+func (d dirFS) MkdirAll(name string, perm fs.FileMode) error {
+	p, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, perm)
+}
+
+func (d dirFS) Remove(name string) error {
+	p, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+func (d dirFS) Rename(oldname, newname string) error {
+	from, err := d.path(oldname)
+	if err != nil {
+		return err
+	}
+	to, err := d.path(newname)
+	if err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+// MemFS is a WriteFS held in memory, to build from or reverse into without
+// touching the disk. Its zero value is not usable; make one with NewMemFS.
+type MemFS struct {
+	fstest.MapFS
+}
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	return &MemFS{MapFS: fstest.MapFS{}}
+}
+
+// WriteFile writes data to the file name. Its directory must exist, as on
+// disk.
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if !fs.ValidPath(name) || name == "." {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	if dir := path.Dir(name); dir != "." {
+		if fi, err := fs.Stat(m.MapFS, dir); err != nil || !fi.IsDir() {
+			return &fs.PathError{Op: "write", Path: name, Err: fs.ErrNotExist}
+		}
+	}
+	if f, ok := m.MapFS[name]; ok && f.Mode.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+	m.MapFS[name] = &fstest.MapFile{Data: append([]byte{}, data...), Mode: perm, ModTime: time.Now()}
+	return nil
+}
+
+// MkdirAll creates the directory name and its parents.
+func (m *MemFS) MkdirAll(name string, perm fs.FileMode) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrInvalid}
+	}
+	for d := name; d != "."; d = path.Dir(d) {
+		if f, ok := m.MapFS[d]; ok {
+			if !f.Mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: name, Err: fmt.Errorf("%s is a file", d)}
+			}
+			continue
+		}
+		m.MapFS[d] = &fstest.MapFile{Mode: fs.ModeDir | perm, ModTime: time.Now()}
+	}
+	return nil
+}
+
+// Remove deletes the file or empty directory name.
+func (m *MemFS) Remove(name string) error {
+	fi, err := fs.Stat(m.MapFS, name)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if fi.IsDir() {
+		for k := range m.MapFS {
+			if strings.HasPrefix(k, name+"/") {
+				return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("directory not empty")}
+			}
+		}
+	}
+	delete(m.MapFS, name)
+	return nil
+}
+
+// Rename moves the file or directory oldname, and everything in it, to
+// newname. newname's directory must exist, and newname must not be a
+// directory.
+func (m *MemFS) Rename(oldname, newname string) error {
+	if !fs.ValidPath(oldname) || !fs.ValidPath(newname) || oldname == "." || newname == "." {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	if _, err := fs.Stat(m.MapFS, oldname); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if dir := path.Dir(newname); dir != "." {
+		if fi, err := fs.Stat(m.MapFS, dir); err != nil || !fi.IsDir() {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+		}
+	}
+	if fi, err := fs.Stat(m.MapFS, newname); err == nil && fi.IsDir() {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	for k, f := range m.MapFS {
+		if k == oldname {
+			delete(m.MapFS, k)
+			m.MapFS[newname] = f
+		} else if strings.HasPrefix(k, oldname+"/") {
+			delete(m.MapFS, k)
+			m.MapFS[newname+k[len(oldname):]] = f
+		}
+	}
+	return nil
+}
+
+// Files lists the names of every file, sorted.
+func (m *MemFS) Files() []string {
+	names := []string{}
+	for k, f := range m.MapFS {
+		if !f.Mode.IsDir() {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sub is the directory dir of fsys, as a WriteFS of its own.
+func Sub(fsys WriteFS, dir string) WriteFS {
+	if dir == "." || dir == "" {
+		return fsys
+	}
+	return subFS{fsys: fsys, dir: dir}
+}
+
+type subFS struct {
+	fsys WriteFS
+	dir  string
+}
+
+func (s subFS) name(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(s.dir, name), nil
+}
+
+func (s subFS) Open(name string) (fs.File, error) {
+	full, err := s.name("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return s.fsys.Open(full)
+}
+
+func (s subFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	full, err := s.name("write", name)
+	if err != nil {
+		return err
+	}
+	return s.fsys.WriteFile(full, data, perm)
+}
+
+func (s subFS) MkdirAll(name string, perm fs.FileMode) error {
+	full, err := s.name("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return s.fsys.MkdirAll(full, perm)
+}
+
+func (s subFS) Remove(name string) error {
+	full, err := s.name("remove", name)
+	if err != nil {
+		return err
+	}
+	return s.fsys.Remove(full)
+}
+
+func (s subFS) Rename(oldname, newname string) error {
+	from, err := s.name("rename", oldname)
+	if err != nil {
+		return err
+	}
+	to, err := s.name("rename", newname)
+	if err != nil {
+		return err
+	}
+	return s.fsys.Rename(from, to)
+}
+
+// SubFS is the directory dir of fsys, writable when fsys is.
+func SubFS(fsys fs.FS, dir string) (fs.FS, error) {
+	if w, ok := fsys.(WriteFS); ok {
+		return Sub(w, dir), nil
+	}
+	return fs.Sub(fsys, dir)
+}
+
+// WriteIfChanged writes b to the file name of fsys, unless it already holds
+// exactly b, so that reversing over an existing tree leaves unchanged files
+// alone. fsys must be a WriteFS.
+func WriteIfChanged(fsys fs.FS, name string, b []byte) error {
+	if existing, err := fs.ReadFile(fsys, name); err == nil && string(existing) == string(b) {
+		return nil
+	}
+	w, ok := fsys.(WriteFS)
+	if !ok {
+		return &fs.PathError{Op: "write", Path: name, Err: ErrReadOnly}
+	}
+	return w.WriteFile(name, b, 0644)
+}
+
+// Remove deletes the file name of fsys, if it exists. fsys must be a
+// WriteFS.
+func Remove(fsys fs.FS, name string) error {
+	w, ok := fsys.(WriteFS)
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: ErrReadOnly}
+	}
+	if err := w.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package file
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMemFS(t *testing.T) {
+	m := NewMemFS()
+	if err := m.WriteFile("src/a.ttslua", []byte("a"), 0644); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("want ErrNotExist writing into a missing folder, got %v", err)
+	}
+	if err := m.MkdirAll("src/lib", 0755); err != nil {
+		t.Fatalf("MkdirAll() : %v", err)
+	}
+	sub := Sub(m, "src")
+	if err := WriteIfChanged(sub, "lib/b.ttslua", []byte("b")); err != nil {
+		t.Fatalf("WriteIfChanged() : %v", err)
+	}
+	if b, err := fs.ReadFile(m, "src/lib/b.ttslua"); err != nil || string(b) != "b" {
+		t.Errorf("want b written through Sub, got %q, %v", b, err)
+	}
+	if err := m.Remove("src/lib"); err == nil {
+		t.Errorf("want an error removing a folder which isn't empty")
+	}
+	if err := Remove(sub, "lib/missing.ttslua"); err != nil {
+		t.Errorf("want removing a missing file ignored, got %v", err)
+	}
+	if got, want := m.Files(), []string{"src/lib/b.ttslua"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if err := sub.Rename("lib", "util"); err != nil {
+		t.Fatalf("Rename() : %v", err)
+	}
+	if got, want := m.Files(), []string{"src/util/b.ttslua"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want the folder moved with its files, %v got %v", want, got)
+	}
+	if err := m.Rename("src/missing", "src/other"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("want ErrNotExist renaming a missing file, got %v", err)
+	}
+
+	ro := fstest.MapFS{"a.json": &fstest.MapFile{Data: []byte("{}")}}
+	if err := WriteIfChanged(ro, "a.json", []byte("{}")); err != nil {
+		t.Errorf("want an unchanged file left alone, got %v", err)
+	}
+	if err := WriteIfChanged(ro, "a.json", []byte("[]")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("want ErrReadOnly, got %v", err)
+	}
+}
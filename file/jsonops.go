@@ -1,102 +1,96 @@
 package file
 
 import (
-	"encoding/json"
+	"ModCreator/ttsjson"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path"
+	"io/fs"
 )
 
 // JSONOps implements the corresponding reader & writer interfaces
 type JSONOps struct {
-	basepath string
+	// fsys holds the files; writing needs it to be a WriteFS.
+	fsys fs.FS
 }
 
 // JSONReader allows for arbitrary reads and encoding of json
 type JSONReader interface {
-	ReadObj(string) (map[string]interface{}, error)
-	ReadObjArray(string) ([]map[string]interface{}, error)
+	ReadObj(string) (*ttsjson.Object, error)
+	ReadObjArray(string) ([]interface{}, error)
 }
 
 // JSONWriter allows for arbitrary writes and encoding of json
 type JSONWriter interface {
-	WriteObj(map[string]interface{}, string) error
-	WriteObjArray([]map[string]interface{}, string) error
+	WriteObj(*ttsjson.Object, string) error
+	WriteObjArray([]interface{}, string) error
+	Remove(string) error
 }
 
 // NewJSONOps initializes our object on a directory
 func NewJSONOps(base string) *JSONOps {
+	return NewJSONOpsFS(DirFS(base))
+}
+
+// NewJSONOpsFS initializes our object on a file system, which files are
+// written to if it is a WriteFS.
+func NewJSONOpsFS(fsys fs.FS) *JSONOps {
 	return &JSONOps{
-		basepath: base,
+		fsys: fsys,
 	}
 }
 
 // ReadObj pulls a file from configs and encodes it as a string.
-func (j *JSONOps) ReadObj(filename string) (map[string]interface{}, error) {
+func (j *JSONOps) ReadObj(filename string) (*ttsjson.Object, error) {
 	b, err := j.pullRawFile(filename)
 	if err != nil {
-		return map[string]interface{}{}, err
+		return ttsjson.NewObject(), err
+	}
+	o, err := ttsjson.UnmarshalObject(b)
+	if err != nil {
+		return ttsjson.NewObject(), fmt.Errorf("ttsjson.UnmarshalObject(%s) : %v", filename, err)
 	}
-	var v map[string]interface{}
-	json.Unmarshal(b, &v)
-	return v, nil
+	return o, nil
 }
 
 // ReadObjArray pulls a file from configs and encodes it as a string.
-func (j *JSONOps) ReadObjArray(filename string) ([]map[string]interface{}, error) {
+func (j *JSONOps) ReadObjArray(filename string) ([]interface{}, error) {
 	b, err := j.pullRawFile(filename)
 	if err != nil {
-		return []map[string]interface{}{}, err
+		return []interface{}{}, err
 	}
-	var v []map[string]interface{}
-	json.Unmarshal(b, &v)
-	return v, nil
-
-}
-func (j *JSONOps) pullRawFile(filename string) ([]byte, error) {
-	p := path.Join(j.basepath, filename)
-	jFile, err := os.Open(p)
+	v, err := ttsjson.Unmarshal(b)
 	if err != nil {
-		return nil, fmt.Errorf("os.Open(%s): %v", p, err)
+		return []interface{}{}, fmt.Errorf("ttsjson.Unmarshal(%s) : %v", filename, err)
+	}
+	arr, ok := v.([]interface{})
+	if !ok {
+		return []interface{}{}, fmt.Errorf("%s does not hold a json array", filename)
 	}
-	defer jFile.Close()
+	return arr, nil
+}
 
-	return ioutil.ReadAll(jFile)
+func (j *JSONOps) pullRawFile(filename string) ([]byte, error) {
+	return fs.ReadFile(j.fsys, filename)
 }
 
 // WriteObj writes a serialized json object to a file.
-func (j *JSONOps) WriteObj(m map[string]interface{}, filename string) error {
-	b, err := json.MarshalIndent(m, "", "  ")
+func (j *JSONOps) WriteObj(m *ttsjson.Object, filename string) error {
+	b, err := ttsjson.Marshal(m)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(path.Join(j.basepath, filename), b, 0644)
+	return WriteIfChanged(j.fsys, filename, b)
 }
 
 // WriteObjArray writes an array of serialized json objects to a file.
-func (j *JSONOps) WriteObjArray(m []map[string]interface{}, filename string) error {
-	b, err := json.MarshalIndent(m, "", "  ")
+func (j *JSONOps) WriteObjArray(m []interface{}, filename string) error {
+	b, err := ttsjson.Marshal(m)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(path.Join(j.basepath, filename), b, 0644)
+	return WriteIfChanged(j.fsys, filename, b)
 }
 
-// ReadRawFile allows for anyone who needs to to read json without objects.
-func ReadRawFile(filename string) (map[string]interface{}, error) {
-	jFile, err := os.Open(filename)
-	if err != nil {
-		return nil, fmt.Errorf("os.Open(%s): %v", filename, err)
-	}
-	defer jFile.Close()
-
-	b, err := ioutil.ReadAll(jFile)
-	if err != nil {
-		return nil, err
-	}
-
-	var v map[string]interface{}
-	json.Unmarshal(b, &v)
-	return v, nil
+// Remove deletes a file, if it exists.
+func (j *JSONOps) Remove(filename string) error {
+	return Remove(j.fsys, filename)
 }
@@ -1,101 +1,301 @@
 package file
 
 import (
+	"ModCreator/ttsjson"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"log"
-	"os"
 	"path"
 	"regexp"
+	"strings"
 )
 
 const (
 	expectedSuffix = ".ttslua"
 )
 
+var (
+	requireLine = regexp.MustCompile(`(?m)^require\((\\)?\"[a-zA-Z0-9/]*(\\)?\"\)\s*$`)
+	requireName = regexp.MustCompile(`require\(\\?"([a-zA-Z0-9/]*)\\?"\)`)
+)
+
 // LuaOps allows for arbitrary reads and writes of luascript
 type LuaOps struct {
+	// fsys holds the scripts; writing needs it to be a WriteFS.
+	fsys            fs.FS
 	basepath        string
 	readFileToBytes func(string) ([]byte, error)
+	modules         map[string]string
+	defines         map[string]bool
 }
 
 // LuaReader serves to describe all ways to read luascripts
 type LuaReader interface {
-	EncodeFromFile(string) (string, error)
-	ReplaceRequire(string) (string, error)
+	ExpandFile(string) (string, []Origin, error)
+	Expand(string) (string, []Origin, error)
+	ReadState(string) (string, error)
+	ReadText(string) (string, error)
 }
 
 // LuaWriter serves to describe all ways to write luascripts
 type LuaWriter interface {
 	EncodeToFile(script, file string) error
+	Remove(file string) error
 }
 
 // NewLuaOps initializes our object on a directory
 func NewLuaOps(base string) *LuaOps {
+	return NewLuaOpsFS(DirFS(base))
+}
+
+// NewLuaOpsFS initializes our object on a file system, which scripts are
+// written to if it is a WriteFS.
+func NewLuaOpsFS(fsys fs.FS) *LuaOps {
 	return &LuaOps{
-		basepath: base,
+		fsys: fsys,
 		readFileToBytes: func(s string) ([]byte, error) {
-			sFile, err := os.Open(s)
-			if err != nil {
-				return nil, fmt.Errorf("os.Open(%s): %v", s, err)
-			}
-			defer sFile.Close()
-
-			return ioutil.ReadAll(sFile)
+			return fs.ReadFile(fsys, s)
 		},
 	}
 }
 
 // EncodeFromFile pulls a file from configs and encodes it as a string.
 func (l *LuaOps) EncodeFromFile(filename string) (string, error) {
-	p := path.Join(l.basepath, filename)
-	b, err := l.readFileToBytes(p)
-	if err != nil {
-		return "", err
-	}
-	s := string(b)
-
-	return l.ReplaceRequire(s)
+	s, _, err := l.ExpandFile(filename)
+	return s, err
 }
 
 // ReplaceRequire will examine any luascript and recursively replace
 // require statements with their contents
 func (l *LuaOps) ReplaceRequire(script string) (string, error) {
-	rsxp := regexp.MustCompile(`(?m)^require\((\\)?\"[a-zA-Z0-9/]*(\\)?\"\)\s*$`)
+	s, _, err := l.Expand(script)
+	return s, err
+}
 
-	notReqs := rsxp.Split(script, -1)
+// Expand is ReplaceRequire, also reporting where each line of the script came
+// from. Lines of script itself have no file.
+func (l *LuaOps) Expand(script string) (string, []Origin, error) {
+	return l.expand(script, "")
+}
 
-	reqs := rsxp.FindAllString(script, -1)
+// AddModule makes script available to require statements as name, without
+// it existing on disk. Modules added this way take precedence over files.
+func (l *LuaOps) AddModule(name, script string) {
+	if l.modules == nil {
+		l.modules = map[string]string{}
+	}
+	l.modules[name+expectedSuffix] = script
+}
 
-	if len(reqs)+1 != len(notReqs) {
-		return "", fmt.Errorf("I've done something wrong with <%s>", script)
+// FileRequires lists the files, relative to the base directory, which
+// filename requires directly once preprocessed, and the size of the script it
+// expands to.
+func (l *LuaOps) FileRequires(filename string) ([]string, int, error) {
+	script, err := l.source(filename)
+	if err != nil {
+		return nil, 0, err
 	}
-	reqsExpanded := []string{}
-	for _, req := range reqs {
-		log.Printf("matching on <%s>\n", req)
+	return l.requires(script, filename)
+}
+
+// ScriptRequires is like FileRequires, for a script not read from a file.
+func (l *LuaOps) ScriptRequires(script string) ([]string, int, error) {
+	return l.requires(script, "")
+}
+
+// DataSize is the size of the lua table an embedded data file becomes.
+func (l *LuaOps) DataSize(filename string) (int, error) {
+	table, err := l.embedData(`require("` + filename + `")`)
+	return len(table), err
+}
+
+func (l *LuaOps) requires(script, filename string) ([]string, int, error) {
+	pre, _, err := l.preprocess(script, filename)
+	if err != nil {
+		return nil, 0, fmt.Errorf("preprocessing %s : %v", filename, err)
+	}
+	expanded, _, err := l.expand(script, filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	return Requires(pre), len(expanded), nil
+}
+
+func (l *LuaOps) source(filename string) (string, error) {
+	if script, ok := l.modules[filename]; ok {
+		return script, nil
+	}
+	b, err := l.readFileToBytes(path.Join(l.basepath, filename))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ReadText reads a file as it is, for values which aren't scripts, like
+// Description, GMNotes or XmlUI: requires, data and preprocessor directives in
+// them are just text.
+func (l *LuaOps) ReadText(filename string) (string, error) {
+	b, err := l.readFileToBytes(path.Join(l.basepath, filename))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
 
-		filexp := regexp.MustCompile(`require\(\\?"([a-zA-Z0-9/]*)\\?"\)`)
-		matches := filexp.FindSubmatch([]byte(req))
-		f := matches[1]
-		exp, err := l.EncodeFromFile(string(f) + expectedSuffix)
+// ExpandFile is EncodeFromFile, also reporting where each line of the script
+// came from.
+func (l *LuaOps) ExpandFile(filename string) (string, []Origin, error) {
+	script, err := l.source(filename)
+	if err != nil {
+		return "", nil, err
+	}
+	return l.expand(script, filename)
+}
+
+func (l *LuaOps) expand(script, filename string) (string, []Origin, error) {
+	script, lineOrigins, err := l.preprocess(script, filename)
+	if err != nil {
+		return "", nil, fmt.Errorf("preprocessing %s : %v", filename, err)
+	}
+	script, err = l.embedData(script)
+	if err != nil {
+		return "", nil, err
+	}
+	m := &mappedScript{origins: []Origin{{}}}
+	prev, line := 0, 1
+	writeSource := func(end int) {
+		chunk := script[prev:end]
+		n := strings.Count(chunk, "\n")
+		m.write(chunk, lineOrigins[line-1:line+n])
+		line += n
+		prev = end
+	}
+	for _, loc := range requireLine.FindAllStringIndex(script, -1) {
+		writeSource(loc[0])
+		m.write("\n", nil)
+
+		req := script[loc[0]:loc[1]]
+		log.Printf("matching on <%s>\n", req)
+		f := requireName.FindStringSubmatch(req)[1]
+		exp, origins, err := l.ExpandFile(f + expectedSuffix)
 		if err != nil {
-			return "", fmt.Errorf("expanding require(%s): %v", f, err)
+			return "", nil, fmt.Errorf("expanding require(%s): %v", f, err)
 		}
-		reqsExpanded = append(reqsExpanded, exp)
+		m.write(exp, origins)
+		m.write("\n", nil)
+
+		line += strings.Count(req, "\n")
+		prev = loc[1]
 	}
+	writeSource(len(script))
 
-	finalStr := ""
-	for i := 0; i < len(reqs); i++ {
-		finalStr += notReqs[i] + "\n"
-		finalStr += reqsExpanded[i] + "\n"
+	return m.sb.String(), m.origins, nil
+}
+
+// Requires lists the files, relative to the base directory, which script
+// requires. Both lua modules and embedded data files are included.
+func Requires(script string) []string {
+	files := []string{}
+	for _, req := range requireLine.FindAllString(script, -1) {
+		files = append(files, requireName.FindStringSubmatch(req)[1]+expectedSuffix)
+	}
+	for _, m := range dataRequire.FindAllStringSubmatch(script, -1) {
+		files = append(files, m[1])
 	}
-	finalStr += notReqs[len(notReqs)-1]
+	return files
+}
+
+// Origin records the file and line a line of expanded script came from. An
+// empty File means the line came from a script which was not read from disk.
+type Origin struct {
+	File string
+	Line int
+}
 
-	return finalStr, nil
+// Originer describes where the lines of the scripts of a built mod came from.
+type Originer interface {
+	// Origins is nil for a script which wasn't expanded, or isn't known.
+	Origins(owner *ttsjson.Object) []Origin
+}
+
+// ScriptOrigins records the origins of the scripts of a built mod, keyed by
+// the object owning the script, or the mod itself for Global.
+type ScriptOrigins map[*ttsjson.Object][]Origin
+
+// Origins implements Originer.
+func (s ScriptOrigins) Origins(owner *ttsjson.Object) []Origin {
+	return s[owner]
+}
+
+func sourceOrigins(filename string, start int, chunk string) []Origin {
+	n := strings.Count(chunk, "\n") + 1
+	origins := make([]Origin, n)
+	for i := range origins {
+		origins[i] = Origin{File: filename, Line: start + i}
+	}
+	return origins
+}
+
+// mappedScript builds a script while remembering the origin of each line.
+type mappedScript struct {
+	sb          strings.Builder
+	origins     []Origin
+	lineStarted bool
+}
+
+// write appends s, whose lines came from origins. Lines without an entry in
+// origins take whatever origin the output line already has.
+func (m *mappedScript) write(s string, origins []Origin) {
+	for i, line := range strings.Split(s, "\n") {
+		if i > 0 {
+			m.sb.WriteString("\n")
+			m.origins = append(m.origins, Origin{})
+			m.lineStarted = false
+		}
+		if !m.lineStarted {
+			if i < len(origins) && origins[i] != (Origin{}) {
+				m.origins[len(m.origins)-1] = origins[i]
+			}
+			m.lineStarted = line != ""
+		}
+		m.sb.WriteString(line)
+	}
+}
+
+// MismatchError is returned by EncodeToFile when an existing script builds
+// into something other than the script being written, and writing over it
+// would lose its requires or preprocessor directives.
+type MismatchError struct {
+	File string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s builds into a different script, and writing over it would inline its requires; it is left unchanged", e.File)
 }
 
 // EncodeToFile takes a single string and decodes escape characters; writes it.
+// An existing script which already builds into script is left in place, so
+// that its requires and preprocessor directives are kept. One which builds
+// into something else is only overwritten if it has neither; otherwise
+// EncodeToFile returns a *MismatchError and leaves it unchanged.
 func (l *LuaOps) EncodeToFile(script, file string) error {
 	p := path.Join(l.basepath, file)
-	return os.WriteFile(p, []byte(script), 0644)
+	existing, err := l.readFileToBytes(p)
+	if err != nil || !strings.HasSuffix(file, expectedSuffix) || string(existing) == script {
+		return WriteIfChanged(l.fsys, p, []byte(script))
+	}
+	built, _, err := l.expand(string(existing), file)
+	if err == nil && built == script {
+		return nil
+	}
+	if err == nil && built == string(existing) {
+		return WriteIfChanged(l.fsys, p, []byte(script))
+	}
+	return &MismatchError{File: file}
+}
+
+// Remove deletes a file, if it exists.
+func (l *LuaOps) Remove(file string) error {
+	return Remove(l.fsys, path.Join(l.basepath, file))
 }
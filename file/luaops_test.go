@@ -2,6 +2,7 @@ package file
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -122,3 +123,49 @@ var y = 55
 		t.Errorf("want <%s> got <%s>", want, got)
 	}
 }
+
+func TestOrigins(t *testing.T) {
+	ff := &fakeFiles{
+		fs: map[string][]byte{
+			"src/base.ttslua": []byte(`local a = 1
+require("foo/bar")
+local b = 2`),
+			"src/foo/bar.ttslua": []byte(`x = 1
+y = 2`),
+		},
+	}
+	l := &LuaOps{
+		basepath:        "src",
+		readFileToBytes: ff.read,
+	}
+
+	got, origins, err := l.ExpandFile("base.ttslua")
+	if err != nil {
+		t.Fatalf("encode error %v", err)
+	}
+	want := map[string]Origin{
+		"local a = 1": {File: "base.ttslua", Line: 1},
+		"x = 1":       {File: "foo/bar.ttslua", Line: 1},
+		"y = 2":       {File: "foo/bar.ttslua", Line: 2},
+		"local b = 2": {File: "base.ttslua", Line: 3},
+	}
+	for i, line := range strings.Split(got, "\n") {
+		w, ok := want[line]
+		if !ok {
+			continue
+		}
+		if origins[i] != w {
+			t.Errorf("line <%s>: want %v got %v", line, w, origins[i])
+		}
+	}
+
+	// an identical script from another file points at that file.
+	ff.fs["src/copy.ttslua"] = ff.fs["src/base.ttslua"]
+	again, copied, err := l.ExpandFile("copy.ttslua")
+	if err != nil {
+		t.Fatalf("encode error %v", err)
+	}
+	if again != got || copied[0] != (Origin{File: "copy.ttslua", Line: 1}) {
+		t.Errorf("want the copy's own origins, got %v", copied)
+	}
+}
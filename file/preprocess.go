@@ -0,0 +1,134 @@
+package file
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// other comments starting with --#, like --#region, are left alone.
+	directive = regexp.MustCompile(`^\s*--#(define|undef|if|elif|else|endif)\b\s*(.*?)\s*$`)
+)
+
+// Define sets preprocessor symbols for every script read afterwards.
+func (l *LuaOps) Define(symbols ...string) {
+	if l.defines == nil {
+		l.defines = map[string]bool{}
+	}
+	for _, s := range symbols {
+		l.defines[s] = true
+	}
+}
+
+// HasDirectives reports whether script uses any preprocessor directives.
+func HasDirectives(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		if directive.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+type condition struct {
+	// active is whether lines in the current branch are kept.
+	active bool
+	// taken is whether any branch of this if has been kept yet.
+	taken bool
+	// outer is whether the enclosing block is kept.
+	outer   bool
+	sawElse bool
+}
+
+// preprocess evaluates --#define, --#undef, --#if, --#elif, --#else and
+// --#endif lines. Directives and the lines they exclude are removed, and the
+// origin of every remaining line is returned alongside.
+func (l *LuaOps) preprocess(script, filename string) (string, []Origin, error) {
+	if !HasDirectives(script) {
+		return script, sourceOrigins(filename, 1, script), nil
+	}
+
+	defined := map[string]bool{}
+	for k, v := range l.defines {
+		defined[k] = v
+	}
+	stack := []condition{}
+	keeping := func() bool {
+		return len(stack) == 0 || stack[len(stack)-1].active
+	}
+
+	kept := []string{}
+	origins := []Origin{}
+	for i, line := range strings.Split(script, "\n") {
+		m := directive.FindStringSubmatch(line)
+		if m == nil {
+			if keeping() {
+				kept = append(kept, line)
+				origins = append(origins, Origin{File: filename, Line: i + 1})
+			}
+			continue
+		}
+		name, arg := m[1], m[2]
+		switch name {
+		case "define":
+			if keeping() {
+				defined[arg] = true
+			}
+		case "undef":
+			if keeping() {
+				delete(defined, arg)
+			}
+		case "if":
+			c := condition{outer: keeping()}
+			c.active = c.outer && evaluate(arg, defined)
+			c.taken = c.active
+			stack = append(stack, c)
+		case "elif", "else":
+			if len(stack) == 0 {
+				return "", nil, fmt.Errorf("line %v: --#%s without --#if", i+1, name)
+			}
+			c := &stack[len(stack)-1]
+			if c.sawElse {
+				return "", nil, fmt.Errorf("line %v: --#%s after --#else", i+1, name)
+			}
+			c.sawElse = name == "else"
+			c.active = c.outer && !c.taken && (name == "else" || evaluate(arg, defined))
+			c.taken = c.taken || c.active
+		case "endif":
+			if len(stack) == 0 {
+				return "", nil, fmt.Errorf("line %v: --#endif without --#if", i+1)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(stack) > 0 {
+		return "", nil, fmt.Errorf("--#if without --#endif")
+	}
+	if len(kept) == 0 {
+		return "", []Origin{{}}, nil
+	}
+	return strings.Join(kept, "\n"), origins, nil
+}
+
+// evaluate checks an --#if condition: a symbol, optionally negated with ! or
+// not, and combined with "and" or "or". "and" binds tighter than "or".
+func evaluate(cond string, defined map[string]bool) bool {
+	for _, alt := range strings.Split(cond, " or ") {
+		all := true
+		for _, term := range strings.Split(alt, " and ") {
+			term = strings.TrimSpace(term)
+			negate := false
+			if strings.HasPrefix(term, "!") {
+				negate, term = true, strings.TrimSpace(term[1:])
+			} else if strings.HasPrefix(term, "not ") {
+				negate, term = true, strings.TrimSpace(term[4:])
+			}
+			all = all && defined[term] != negate
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
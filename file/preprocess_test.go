@@ -0,0 +1,53 @@
+package file
+
+import "testing"
+
+func TestPreprocess(t *testing.T) {
+	ff := &fakeFiles{
+		fs: map[string][]byte{
+			"src/base.ttslua": []byte(`a = 1
+--#if DEBUG
+debug = true
+--#elif RELEASE and not DEBUG
+release = true
+--#else
+other = true
+--#endif
+--#region kept
+--#define LOCAL
+--#if LOCAL
+b = 2
+--#endif`),
+		},
+	}
+	l := &LuaOps{
+		basepath:        "src",
+		readFileToBytes: ff.read,
+	}
+	l.Define("RELEASE")
+
+	got, origins, err := l.ExpandFile("base.ttslua")
+	if err != nil {
+		t.Fatalf("encode error %v", err)
+	}
+	want := `a = 1
+release = true
+--#region kept
+b = 2`
+	if want != got {
+		t.Errorf("want <%s> got <%s>", want, got)
+	}
+	wantLines := []int{1, 5, 9, 12}
+	for i, o := range origins {
+		if o.Line != wantLines[i] {
+			t.Errorf("line %v: want origin %v got %v", i+1, wantLines[i], o.Line)
+		}
+	}
+}
+
+func TestPreprocessUnbalanced(t *testing.T) {
+	l := &LuaOps{}
+	if _, err := l.ReplaceRequire("--#if DEBUG\nx = 1"); err == nil {
+		t.Errorf("expected error for missing --#endif")
+	}
+}
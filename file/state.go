@@ -0,0 +1,56 @@
+package file
+
+import (
+	"ModCreator/ttsjson"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// StateExt is the extension of a LuaScriptState file which holds json.
+const StateExt = ".state.json"
+
+// PrettyState returns state indented for editing, if it is a json object or
+// array which compacts back to exactly state. Otherwise ok is false, and state
+// should be kept as text.
+func PrettyState(state string) (pretty string, ok bool) {
+	v, err := ttsjson.Unmarshal([]byte(state))
+	if err != nil {
+		return "", false
+	}
+	switch v.(type) {
+	case *ttsjson.Object, []interface{}:
+	default:
+		return "", false
+	}
+	compact, err := ttsjson.MarshalCompact(v)
+	if err != nil || string(compact) != state {
+		return "", false
+	}
+	b, err := ttsjson.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// ReadState reads a LuaScriptState file. A .json file is data, so it is
+// compacted again. Any other file is read as ReadText does.
+func (l *LuaOps) ReadState(filename string) (string, error) {
+	if !strings.HasSuffix(filename, ".json") {
+		return l.ReadText(filename)
+	}
+	b, err := l.readFileToBytes(path.Join(l.basepath, filename))
+	if err != nil {
+		return "", err
+	}
+	v, err := ttsjson.Unmarshal(b)
+	if err != nil {
+		return "", fmt.Errorf("%s : %v", filename, err)
+	}
+	compact, err := ttsjson.MarshalCompact(v)
+	if err != nil {
+		return "", fmt.Errorf("%s : %v", filename, err)
+	}
+	return string(compact), nil
+}
@@ -0,0 +1,51 @@
+package file
+
+import "testing"
+
+func TestPrettyState(t *testing.T) {
+	state := `{"turn":3,"players":["Red","Blue"],"board":{"x":1.50,"note":"require(\"lib\")"},"empty":{}}`
+	pretty, ok := PrettyState(state)
+	if !ok {
+		t.Fatalf("want %s to be json state", state)
+	}
+	want := `{
+  "turn": 3,
+  "players": [
+    "Red",
+    "Blue"
+  ],
+  "board": {
+    "x": 1.50,
+    "note": "require(\"lib\")"
+  },
+  "empty": {}
+}
+`
+	if pretty != want {
+		t.Errorf("want <%s> got <%s>", want, pretty)
+	}
+
+	ff := &fakeFiles{fs: map[string][]byte{"src/a.state.json": []byte(pretty)}}
+	l := &LuaOps{basepath: "src", readFileToBytes: ff.read}
+	got, err := l.ReadState("a.state.json")
+	if err != nil {
+		t.Fatalf("ReadState() : %v", err)
+	}
+	if got != state {
+		t.Errorf("want <%s> got <%s>", state, got)
+	}
+}
+
+func TestPrettyStateText(t *testing.T) {
+	for _, state := range []string{
+		"just some text",
+		`{"spaced": 1}`,
+		`"a string"`,
+		`12`,
+		`{"a":1} trailing`,
+	} {
+		if _, ok := PrettyState(state); ok {
+			t.Errorf("want %s kept as text", state)
+		}
+	}
+}
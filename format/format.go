@@ -0,0 +1,305 @@
+// Package format rewrites a config directory into one canonical layout, so
+// that different editors don't cause noisy diffs.
+package format
+
+import (
+	"ModCreator/file"
+	"ModCreator/objects"
+	"ModCreator/ttsjson"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var (
+	// saveOrder is the order TTS writes the top level keys of a save in.
+	saveOrder = []string{
+		"SaveName", "EpochTime", "Date", "VersionNumber", "GameMode", "GameType",
+		"GameComplexity", "PlayingTime", "PlayerCounts", "Tags", "Gravity",
+		"PlayArea", "Table", "TableURL", "Sky", "SkyURL", "Note", "TabStates",
+		"MusicPlayer", "Grid", "Lighting", "Hands", "ComponentTags", "Turns",
+		"CameraStates", "DecalPallet", "LuaScript", "LuaScriptState", "XmlUI",
+		"CustomUIAssets", "SnapPoints", "ObjectStates",
+	}
+	// objectOrder is the order TTS writes the keys of an object in.
+	objectOrder = []string{
+		"GUID", "Name", "Transform", "Nickname", "Description", "GMNotes",
+		"AltLookAngle", "ColorDiffuse", "Tags", "LayoutGroupSortIndex", "Value",
+		"Locked", "Grid", "Snap", "IgnoreFoW", "MeasureMovement", "DragSelectable",
+		"Autoraise", "Sticky", "Tooltip", "GridProjection", "HideWhenFaceDown",
+		"Hands", "AltSound", "FogColor", "FogHidePointers", "FogReverseHiding",
+		"FogSeethrough", "Text", "MaterialIndex", "MeshIndex", "Number",
+		"CustomMesh", "Bag", "CustomAssetbundle", "CustomImage", "CardID",
+		"SidewaysCard", "RPGmode", "RPGdead", "CustomPDF", "DeckIDs", "CustomDeck",
+		"Counter", "Clock", "Tablet", "Mp3Player", "Calculator", "FogOfWar",
+		"FogOfWarRevealer", "LuaScript", "LuaScriptState", "XmlUI",
+		"CustomUIAssets", "ContainedObjects", "PhysicsMaterial", "Rigidbody",
+		"JointFixed", "JointHinge", "JointSpring", "AttachedSnapPoints",
+		"AttachedVectorLines", "AttachedDecals", "States", "RotationValues",
+		"ChildObjects",
+	}
+	// fieldOrder is the order TTS writes the keys of every other json object
+	// in, such as a Transform, a color or a CustomMesh. No two kinds of object
+	// order their shared keys differently, so one list covers them all.
+	fieldOrder = []string{
+		"title", "body", "color", "visibleColor", "id", "r", "g", "b",
+		"RepeatSong", "PlaylistEntry", "CurrentAudioTitle", "CurrentAudioURL",
+		"AudioLibrary", "Item1", "Item2", "x", "y", "z", "LightIntensity",
+		"LightColor", "AmbientIntensity", "AmbientType", "AmbientSkyColor",
+		"AmbientEquatorColor", "AmbientGroundColor", "ReflectionIntensity",
+		"LutIndex", "LutContribution", "LutURL", "Enable", "DisableUnused",
+		"Hiding", "labels", "displayed", "normalized", "Position", "Rotation",
+		"Distance", "Zoomed", "AbsolutePosition", "Name", "URL", "Tags", "posX",
+		"posY", "posZ", "rotX", "rotY", "rotZ", "scaleX", "scaleY", "scaleZ", "a",
+		"Text", "colorstate", "fontSize", "MeshURL", "DiffuseURL", "NormalURL",
+		"ColliderURL", "Convex", "SpecularColor", "SpecularIntensity",
+		"SpecularSharpness", "FresnelStrength", "Order", "AssetbundleURL",
+		"AssetbundleSecondaryURL", "MaterialIndex", "TypeIndex", "CustomShader",
+		"CastShadows", "LoopingEffectIndex", "ImageURL", "ImageSecondaryURL",
+		"ImageScalar", "WidthScale", "CustomToken", "FaceURL", "BackURL",
+		"NumWidth", "NumHeight", "BackIsHidden", "UniqueBack", "Type", "Lines",
+		"Color", "Opacity", "ThickLines", "Snapping", "Offset", "BothSnapping",
+		"xSize", "ySize", "PosOffset", "TurnOrder", "Reverse", "SkipEmpty",
+		"DisableInteractions", "PassTurns", "TurnColor", "Thickness",
+		"MergeDistancePixels", "StandUp", "Stackable", "PDFUrl", "PDFPassword",
+		"PDFPage", "PDFPageOffset", "Transform", "CustomDecal", "Size",
+		"CustomTile", "Stretch", "value",
+	}
+)
+
+// Tree formats config.json, every json file under jsonSubdir and objectsSubdir,
+// and every script under textSubdir, in the config directory fsys. Files are
+// only rewritten when check is false, so fsys must be a file.WriteFS unless it
+// is set. It returns the files which were not already formatted.
+func Tree(fsys fs.FS, textSubdir, jsonSubdir, objectsSubdir string, check bool) ([]string, error) {
+	type job struct {
+		dir    string
+		filter func(name string) bool
+		format func([]byte) ([]byte, error)
+	}
+	isJSON := func(name string) bool { return strings.HasSuffix(name, ".json") }
+	jobs := []job{
+		{dir: jsonSubdir, filter: isJSON, format: JSON},
+		{dir: objectsSubdir, filter: isJSON, format: Object},
+		{dir: textSubdir, filter: func(string) bool { return true }, format: func(b []byte) ([]byte, error) {
+			return Script(b), nil
+		}},
+	}
+
+	changed := []string{}
+	visit := func(rel string, format func([]byte) ([]byte, error)) error {
+		b, err := fs.ReadFile(fsys, rel)
+		if err != nil {
+			return fmt.Errorf("fs.ReadFile(%s) : %v", rel, err)
+		}
+		formatted, err := format(b)
+		if err != nil {
+			return fmt.Errorf("formatting %s : %v", rel, err)
+		}
+		if bytes.Equal(b, formatted) {
+			return nil
+		}
+		changed = append(changed, rel)
+		if check {
+			return nil
+		}
+		return file.WriteIfChanged(fsys, rel, formatted)
+	}
+
+	if err := visit("config.json", Config); err != nil {
+		return changed, err
+	}
+	for _, j := range jobs {
+		err := fs.WalkDir(fsys, path.Clean(j.dir), func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !j.filter(d.Name()) {
+				return nil
+			}
+			return visit(p, j.format)
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// Config formats the contents of config.json.
+func Config(b []byte) ([]byte, error) {
+	o, err := ttsjson.UnmarshalObject(b)
+	if err != nil {
+		return nil, err
+	}
+	canonical(o)
+	sortBy(o, saveOrder)
+	if objs, ok := o.Array("ObjectStates"); ok {
+		for _, obj := range objs {
+			if sub, ok := obj.(*ttsjson.Object); ok {
+				object(sub)
+			}
+		}
+	}
+	return ttsjson.Marshal(o)
+}
+
+// Object formats an object file from the objects directory.
+func Object(b []byte) ([]byte, error) {
+	o, err := ttsjson.UnmarshalObject(b)
+	if err != nil {
+		return nil, err
+	}
+	canonical(o)
+	object(o)
+	return ttsjson.Marshal(o)
+}
+
+// JSON formats any other json file.
+func JSON(b []byte) ([]byte, error) {
+	v, err := ttsjson.Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return ttsjson.Marshal(canonical(v))
+}
+
+// Script gives a script unix line endings.
+func Script(b []byte) []byte {
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(b, []byte("\r"), []byte("\n"))
+}
+
+// object puts the keys of o, its states and any objects it contains in TTS
+// order.
+func object(o *ttsjson.Object) {
+	sortBy(o, objectOrder)
+	if states, ok := o.Object("States"); ok {
+		for _, k := range states.Keys() {
+			if state, ok := states.Object(k); ok {
+				object(state)
+			}
+		}
+	}
+	for _, k := range []string{"ContainedObjects", "ChildObjects"} {
+		subs, _ := o.Array(k)
+		for _, raw := range subs {
+			if sub, ok := raw.(*ttsjson.Object); ok {
+				object(sub)
+			}
+		}
+	}
+}
+
+// canonical formats every number in v, and puts the keys of every object in
+// fieldOrder. Objects keyed by numbers, like CustomDeck and States, keep their
+// order since TTS doesn't sort them.
+func canonical(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		return Number(val)
+	case []interface{}:
+		for i, e := range val {
+			val[i] = canonical(e)
+		}
+	case *ttsjson.Object:
+		for _, k := range val.Keys() {
+			e, _ := val.Get(k)
+			val.Set(k, canonical(e))
+		}
+		if !numbered(val) {
+			sortBy(val, fieldOrder)
+		}
+	}
+	return v
+}
+
+func numbered(o *ttsjson.Object) bool {
+	for _, k := range o.Keys() {
+		if _, err := strconv.Atoi(k); err != nil {
+			return false
+		}
+	}
+	return o.Len() > 0
+}
+
+// sortBy orders the keys of o as listed in order. A _path or _order key goes
+// where the key it stands in for would. Keys not in order come last, sorted
+// by name.
+func sortBy(o *ttsjson.Object, order []string) {
+	rank := map[string]int{}
+	for i, k := range order {
+		rank[k] = i
+	}
+	type place struct {
+		known bool
+		rank  int
+		base  string
+		sub   int
+	}
+	placeOf := func(k string) place {
+		base, sub := k, 0
+		if strings.HasSuffix(k, "_path") {
+			base = strings.TrimSuffix(k, "_path")
+		} else if strings.HasSuffix(k, objects.OrderKey) {
+			base, sub = strings.TrimSuffix(k, objects.OrderKey), 1
+		}
+		r, ok := rank[base]
+		return place{known: ok, rank: r, base: base, sub: sub}
+	}
+	o.SortKeys(func(a, b string) bool {
+		pa, pb := placeOf(a), placeOf(b)
+		if pa.known != pb.known {
+			return pa.known
+		}
+		if pa.known && pa.rank != pb.rank {
+			return pa.rank < pb.rank
+		}
+		if pa.base != pb.base {
+			return pa.base < pb.base
+		}
+		return pa.sub < pb.sub
+	})
+}
+
+// Number writes a number literal the way TTS does. Integers are left alone.
+// Decimals lose trailing zeros but keep one digit after the point, and
+// exponents are written like E-05.
+func Number(n json.Number) json.Number {
+	s := string(n)
+	if !strings.ContainsAny(s, ".eE") {
+		return n
+	}
+	mant, exp := s, ""
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mant, exp = s[:i], s[i+1:]
+	}
+	if strings.Contains(mant, ".") {
+		mant = strings.TrimRight(mant, "0")
+		if exp != "" {
+			mant = strings.TrimSuffix(mant, ".")
+		} else if strings.HasSuffix(mant, ".") {
+			mant += "0"
+		}
+	}
+	if exp == "" {
+		return json.Number(mant)
+	}
+	sign := "+"
+	if exp[0] == '+' || exp[0] == '-' {
+		if exp[0] == '-' {
+			sign = "-"
+		}
+		exp = exp[1:]
+	}
+	exp = strings.TrimLeft(exp, "0")
+	for len(exp) < 2 {
+		exp = "0" + exp
+	}
+	return json.Number(mant + "E" + sign + exp)
+}
@@ -0,0 +1,114 @@
+package format
+
+import (
+	"ModCreator/file"
+	"encoding/json"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestNumber(t *testing.T) {
+	cases := map[string]string{
+		"12":          "12",
+		"-3":          "-3",
+		"1.0":         "1.0",
+		"1.500":       "1.5",
+		"2.":          "2.0",
+		"6.36111e-14": "6.36111E-14",
+		"1.50E5":      "1.5E+05",
+		"1.0E-5":      "1E-05",
+		"-2E+015":     "-2E+15",
+	}
+	for in, want := range cases {
+		if got := Number(json.Number(in)); string(got) != want {
+			t.Errorf("Number(%s) : want %s got %s", in, want, got)
+		}
+	}
+}
+
+func TestObject(t *testing.T) {
+	in := `{"Nickname": "Board", "Zebra": 1, "LuaScript_path": "Board.ttslua", "Apple": 2,
+	"Transform": {"scaleX": 1.00, "posX": 0}, "GUID": "abc123", "Name": "Custom_Board",
+	"ContainedObjects_order": ["b.json", "a.json"], "ContainedObjects_path": "abc123",
+	"CustomDeck": {"5": {"FaceURL": "f"}, "2": {"BackURL": "b", "FaceURL": "f"}}}`
+	want := `{
+  "GUID": "abc123",
+  "Name": "Custom_Board",
+  "Transform": {
+    "posX": 0,
+    "scaleX": 1.0
+  },
+  "Nickname": "Board",
+  "CustomDeck": {
+    "5": {
+      "FaceURL": "f"
+    },
+    "2": {
+      "FaceURL": "f",
+      "BackURL": "b"
+    }
+  },
+  "LuaScript_path": "Board.ttslua",
+  "ContainedObjects_path": "abc123",
+  "ContainedObjects_order": [
+    "b.json",
+    "a.json"
+  ],
+  "Apple": 2,
+  "Zebra": 1
+}
+`
+	got, err := Object([]byte(in))
+	if err != nil {
+		t.Fatalf("Object() : %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("want <%s> got <%s>", want, got)
+	}
+	again, err := Object(got)
+	if err != nil {
+		t.Fatalf("Object() : %v", err)
+	}
+	if string(again) != string(got) {
+		t.Errorf("formatting is not stable: <%s>", again)
+	}
+}
+
+func TestScript(t *testing.T) {
+	if got := string(Script([]byte("a\r\nb\rc\n"))); got != "a\nb\nc\n" {
+		t.Errorf("want unix line endings, got %q", got)
+	}
+}
+
+func TestTree(t *testing.T) {
+	m := file.NewMemFS()
+	if err := m.MkdirAll("src", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"config.json":   "{\n  \"SaveName\": \"Mod\"\n}\n",
+		"src/a.ttslua":  "a\r\n",
+		"src/ok.ttslua": "ok\n",
+	} {
+		if err := m.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changed, err := Tree(m, "src", "json", "objects", true)
+	if err != nil {
+		t.Fatalf("Tree() : %v", err)
+	}
+	if want := []string{"src/a.ttslua"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("want %v got %v", want, changed)
+	}
+	if b, _ := fs.ReadFile(m, "src/a.ttslua"); string(b) != "a\r\n" {
+		t.Errorf("want nothing written with check set, got %q", b)
+	}
+	if _, err := Tree(m, "src", "json", "objects", false); err != nil {
+		t.Fatalf("Tree() : %v", err)
+	}
+	if b, _ := fs.ReadFile(m, "src/a.ttslua"); string(b) != "a\n" {
+		t.Errorf("want the script rewritten, got %q", b)
+	}
+}
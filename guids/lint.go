@@ -0,0 +1,110 @@
+package guids
+
+import (
+	"ModCreator/file"
+	"ModCreator/objects"
+	"ModCreator/ttsjson"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// IgnoreComment suppresses unknown GUID reports for the line it is on.
+	IgnoreComment = "--guidlint:ignore"
+)
+
+var (
+	guidLiteral = regexp.MustCompile(`["']([0-9a-fA-F]{6})["']`)
+)
+
+// Unknown is a GUID referenced by a script which no object in the mod has.
+type Unknown struct {
+	GUID string
+	// File and Line locate the reference in the source tree. File is empty
+	// when the script was not read from a file.
+	File string
+	Line int
+	// Owner is the GUID of the object whose script held the reference, or
+	// "Global".
+	Owner string
+}
+
+func (u Unknown) String() string {
+	where := fmt.Sprintf("%s/LuaScript:%v", u.Owner, u.Line)
+	if u.File != "" {
+		where = fmt.Sprintf("%s:%v", u.File, u.Line)
+	}
+	return fmt.Sprintf("%s: unknown GUID %s", where, u.GUID)
+}
+
+// Collect returns every GUID in objs, including objects in containers and
+// alternate states.
+func Collect(objs interface{}) map[string]bool {
+	all := map[string]bool{}
+	objects.Walk(objs, func(o *ttsjson.Object) {
+		if g, ok := o.String("GUID"); ok {
+			all[g] = true
+		}
+	})
+	return all
+}
+
+// Lint looks through the Global script and every object script in a built mod
+// for GUID string literals which don't belong to any object.
+func Lint(mod *ttsjson.Object, o file.Originer) []Unknown {
+	objs, _ := mod.Get("ObjectStates")
+	known := Collect(objs)
+
+	found := []Unknown{}
+	seen := map[Unknown]bool{}
+	check := func(owner string, obj *ttsjson.Object, script string) {
+		origins := o.Origins(obj)
+		for i, line := range strings.Split(script, "\n") {
+			if strings.Contains(line, IgnoreComment) {
+				continue
+			}
+			for _, m := range guidLiteral.FindAllStringSubmatch(line, -1) {
+				if known[m[1]] {
+					continue
+				}
+				u := Unknown{GUID: m[1], Line: i + 1, Owner: owner}
+				if i < len(origins) && origins[i].File != "" {
+					u.File = origins[i].File
+					u.Line = origins[i].Line
+					// the same library may be required by many objects.
+					u.Owner = ""
+				}
+				if seen[u] {
+					continue
+				}
+				seen[u] = true
+				found = append(found, u)
+			}
+		}
+	}
+
+	if s, ok := mod.String("LuaScript"); ok {
+		check("Global", mod, s)
+	}
+	objects.Walk(objs, func(obj *ttsjson.Object) {
+		s, ok := obj.String("LuaScript")
+		if !ok {
+			return
+		}
+		g, _ := obj.String("GUID")
+		check(g, obj, s)
+	})
+
+	sort.SliceStable(found, func(i, k int) bool {
+		if found[i].File != found[k].File {
+			return found[i].File < found[k].File
+		}
+		if found[i].Owner != found[k].Owner {
+			return found[i].Owner < found[k].Owner
+		}
+		return found[i].Line < found[k].Line
+	})
+	return found
+}
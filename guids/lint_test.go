@@ -0,0 +1,45 @@
+package guids
+
+import (
+	"ModCreator/file"
+	"ModCreator/ttsjson"
+	"testing"
+)
+
+type noOrigins struct{}
+
+func (noOrigins) Origins(*ttsjson.Object) []file.Origin { return nil }
+
+func TestLint(t *testing.T) {
+	mod := map[string]interface{}{
+		"LuaScript": `local a = getObjectFromGUID("abc123")
+local b = getObjectFromGUID("ffffff")
+local c = getObjectFromGUID("eeeeee") --guidlint:ignore`,
+		"ObjectStates": []interface{}{
+			map[string]interface{}{
+				"GUID":      "abc123",
+				"LuaScript": `x = getObjectFromGUID('def456')`,
+				"ContainedObjects": []interface{}{
+					map[string]interface{}{"GUID": "def456"},
+				},
+				"States": map[string]interface{}{
+					"2": map[string]interface{}{"GUID": "123456", "LuaScript": `y = "999999"`},
+				},
+			},
+		},
+	}
+
+	got := Lint(ttsjson.Convert(mod).(*ttsjson.Object), noOrigins{})
+	want := []Unknown{
+		{GUID: "999999", Line: 1, Owner: "123456"},
+		{GUID: "ffffff", Line: 2, Owner: "Global"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("want %v got %v", want[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package guids
+
+import (
+	"ModCreator/objects"
+	"ModCreator/ttsjson"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// ModuleName is what scripts require to get the generated GUID table.
+	ModuleName = "generated/guids"
+	// ScriptNameKey is an optional object field which names the object in the
+	// generated module instead of its Nickname or Name.
+	ScriptNameKey = "ScriptName"
+	// TableName is the global the generated module defines.
+	TableName = "GUIDS"
+)
+
+// Entry is a single named GUID in the generated module.
+type Entry struct {
+	Key      string
+	GUID     string
+	Name     string
+	Nickname string
+}
+
+// Entries names every object in objs. Names come from ScriptName, then
+// Nickname, then Name. When several objects share a name, each of them is
+// suffixed by its GUID so that no reference is ambiguous.
+func Entries(objs interface{}) []Entry {
+	all := []Entry{}
+	objects.Walk(objs, func(o *ttsjson.Object) {
+		g, ok := o.String("GUID")
+		if !ok {
+			return
+		}
+		e := Entry{GUID: g}
+		e.Name, _ = o.String("Name")
+		e.Nickname, _ = o.String("Nickname")
+		scriptName, _ := o.String(ScriptNameKey)
+		for _, candidate := range []string{scriptName, e.Nickname, e.Name} {
+			if e.Key = Identifier(candidate); e.Key != "" {
+				break
+			}
+		}
+		if e.Key == "" {
+			e.Key = "_" + g
+		}
+		all = append(all, e)
+	})
+
+	count := map[string]int{}
+	for _, e := range all {
+		count[e.Key]++
+	}
+	for i := range all {
+		if count[all[i].Key] > 1 {
+			all[i].Key = all[i].Key + "_" + all[i].GUID
+		}
+	}
+	sort.SliceStable(all, func(i, k int) bool {
+		return all[i].Key < all[k].Key
+	})
+	return all
+}
+
+// Identifier turns an arbitrary object name into a lua identifier, such as
+// "Main Board" into "MainBoard". Characters lua doesn't allow are dropped.
+func Identifier(name string) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range name {
+		isAlnum := ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+		if !isAlnum {
+			// letters lua can't use are dropped without starting a new word.
+			upper = upper || !unicode.IsLetter(r)
+			continue
+		}
+		if upper && 'a' <= r && r <= 'z' {
+			r = r - 'a' + 'A'
+		}
+		upper = false
+		sb.WriteRune(r)
+	}
+	id := sb.String()
+	if id != "" && '0' <= id[0] && id[0] <= '9' {
+		id = "_" + id
+	}
+	return id
+}
+
+// Module generates the lua source of the GUID table. When annotate is set,
+// EmmyLua annotations describe every field for editor autocompletion.
+func Module(objs interface{}, annotate bool) string {
+	entries := Entries(objs)
+
+	var sb strings.Builder
+	sb.WriteString("-- Generated by ModCreator from the objects directory. Do not edit.\n")
+	if annotate {
+		sb.WriteString("---@class GeneratedGUIDs\n")
+		for _, e := range entries {
+			desc := e.Name
+			if e.Nickname != "" {
+				desc = fmt.Sprintf("%s %q", e.Name, e.Nickname)
+			}
+			fmt.Fprintf(&sb, "---@field %s string %s\n", e.Key, desc)
+		}
+		sb.WriteString("---@type GeneratedGUIDs\n")
+	}
+	sb.WriteString(TableName + " = {\n")
+	for _, e := range entries {
+		fmt.Fprintf(&sb, "  %s = %q,\n", e.Key, e.GUID)
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// StripScriptNames removes the ScriptName field, which TTS doesn't know about,
+// from every object in objs.
+func StripScriptNames(objs interface{}) {
+	objects.Walk(objs, func(o *ttsjson.Object) {
+		o.Delete(ScriptNameKey)
+	})
+}
@@ -0,0 +1,43 @@
+package guids
+
+import (
+	"ModCreator/ttsjson"
+	"testing"
+)
+
+func TestIdentifier(t *testing.T) {
+	for in, want := range map[string]string{
+		"Main Board":  "MainBoard",
+		"Custom_Tile": "CustomTile",
+		"3DText":      "_3DText",
+		"déjà vu":     "DjVu",
+		"":            "",
+	} {
+		if got := Identifier(in); got != want {
+			t.Errorf("Identifier(%s): want <%s> got <%s>", in, want, got)
+		}
+	}
+}
+
+func TestModule(t *testing.T) {
+	objs := []map[string]interface{}{
+		{"GUID": "aaaaaa", "Name": "Custom_Board", "Nickname": "Main Board"},
+		{"GUID": "bbbbbb", "Name": "Card", "ScriptName": "first"},
+		{"GUID": "cccccc", "Name": "Deck", "ContainedObjects": []interface{}{
+			map[string]interface{}{"GUID": "dddddd", "Name": "Card"},
+			map[string]interface{}{"GUID": "eeeeee", "Name": "Card"},
+		}},
+	}
+
+	want := `-- Generated by ModCreator from the objects directory. Do not edit.
+GUIDS = {
+  Card_dddddd = "dddddd",
+  Card_eeeeee = "eeeeee",
+  Deck = "cccccc",
+  First = "bbbbbb",
+  MainBoard = "aaaaaa",
+}`
+	if got := Module(ttsjson.Convert(objs), false); got != want {
+		t.Errorf("want <%s> got <%s>", want, got)
+	}
+}
@@ -0,0 +1,365 @@
+// Package lint looks for structural problems in a config directory which a
+// build would otherwise ignore or only report one at a time.
+package lint
+
+import (
+	"ModCreator/file"
+	"ModCreator/objects"
+	"ModCreator/ttsjson"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Rules a Finding can break.
+const (
+	MissingFile    = "missing-file"
+	UnusedFile     = "unused-file"
+	UnclaimedDir   = "unclaimed-dir"
+	ClaimedTwice   = "claimed-twice"
+	NonStringPath  = "non-string-path"
+	MissingField   = "missing-field"
+	InvalidJSON    = "invalid-json"
+	pathExt        = "_path"
+	testSuffix     = "_test.ttslua"
+	configFileName = "config.json"
+)
+
+// requiredFields must be in every object.
+var requiredFields = []string{"GUID", "Name", "Transform"}
+
+// Finding is a single problem, in the file (relative to the config directory)
+// where it can be fixed.
+type Finding struct {
+	File    string `json:"file"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.File, f.Rule, f.Message)
+}
+
+// Tree describes the layout of a config directory.
+type Tree struct {
+	// FS is the config directory.
+	FS            fs.FS
+	TextSubdir    string
+	JSONSubdir    string
+	ObjectsSubdir string
+	// TextKeys are the config.json keys whose _path names a file under
+	// TextSubdir. Any other _path names a file under JSONSubdir, unless it
+	// isn't a .json file.
+	TextKeys []string
+	// Modules are generated at build time, so requiring them needs no file.
+	Modules []string
+}
+
+type linter struct {
+	t        Tree
+	found    []Finding
+	scripts  map[string]bool
+	jsonUsed map[string]bool
+	// pending are scripts, and where they were referenced from, whose
+	// requires haven't been followed yet.
+	pending []reference
+}
+
+type reference struct {
+	from   string
+	script string
+}
+
+// Run checks the config directory described by t.
+func Run(t Tree) ([]Finding, error) {
+	l := &linter{t: t, found: []Finding{}, scripts: map[string]bool{}, jsonUsed: map[string]bool{}}
+	for _, m := range t.Modules {
+		l.scripts[m+".ttslua"] = true
+	}
+	l.config()
+	if err := l.objects(t.ObjectsSubdir); err != nil {
+		return nil, err
+	}
+	if err := l.tests(); err != nil {
+		return nil, err
+	}
+	l.follow()
+	if err := l.unused(t.TextSubdir, l.scripts); err != nil {
+		return nil, err
+	}
+	if err := l.unused(t.JSONSubdir, l.jsonUsed); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(l.found, func(i, k int) bool {
+		a, b := l.found[i], l.found[k]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Message < b.Message
+	})
+	return l.found, nil
+}
+
+func (l *linter) report(file, rule, format string, args ...interface{}) {
+	l.found = append(l.found, Finding{File: file, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) exists(rel string) bool {
+	_, err := fs.Stat(l.t.FS, rel)
+	return err == nil
+}
+
+func (l *linter) read(rel string) (*ttsjson.Object, bool) {
+	b, err := fs.ReadFile(l.t.FS, rel)
+	if err != nil {
+		l.report(rel, MissingFile, "%v", err)
+		return nil, false
+	}
+	o, err := ttsjson.UnmarshalObject(b)
+	if err != nil {
+		l.report(rel, InvalidJSON, "%v", err)
+		return nil, false
+	}
+	return o, true
+}
+
+// script notes that from uses the script file name under TextSubdir.
+func (l *linter) script(from, key, name string) {
+	rel := path.Join(l.t.TextSubdir, name)
+	if !l.scripts[name] && !l.exists(rel) {
+		l.report(from, MissingFile, "%s names %s, which doesn't exist", key, rel)
+		return
+	}
+	l.use(from, name)
+}
+
+func (l *linter) use(from, name string) {
+	if l.scripts[name] {
+		return
+	}
+	l.scripts[name] = true
+	b, err := fs.ReadFile(l.t.FS, path.Join(l.t.TextSubdir, name))
+	if err == nil {
+		l.pending = append(l.pending, reference{from: path.Join(l.t.TextSubdir, name), script: string(b)})
+	}
+}
+
+// follow marks everything the collected scripts require as used.
+func (l *linter) follow() {
+	for len(l.pending) > 0 {
+		ref := l.pending[0]
+		l.pending = l.pending[1:]
+		for _, name := range file.Requires(ref.script) {
+			l.script(ref.from, "require", name)
+		}
+	}
+}
+
+func (l *linter) config() {
+	c, ok := l.read(configFileName)
+	if !ok {
+		return
+	}
+	text := map[string]bool{}
+	for _, k := range l.t.TextKeys {
+		text[k] = true
+	}
+	for _, k := range c.Keys() {
+		v, _ := c.Get(k)
+		if !strings.HasSuffix(k, pathExt) {
+			if s, ok := v.(string); ok && text[k] {
+				l.pending = append(l.pending, reference{from: configFileName, script: s})
+			}
+			continue
+		}
+		name, ok := v.(string)
+		if !ok {
+			l.report(configFileName, NonStringPath, "%s is %v, not a file name", k, v)
+			continue
+		}
+		base := strings.TrimSuffix(k, pathExt)
+		switch {
+		case base == "ObjectStates":
+			// only marks where the objects go.
+		case text[base] || !strings.HasSuffix(name, ".json"):
+			l.script(configFileName, k, name)
+		default:
+			rel := path.Join(l.t.JSONSubdir, name)
+			if !l.exists(rel) {
+				l.report(configFileName, MissingFile, "%s names %s, which doesn't exist", k, rel)
+				continue
+			}
+			l.jsonUsed[name] = true
+		}
+	}
+}
+
+// objects checks every object file in dir, then the folders they claim.
+func (l *linter) objects(dir string) error {
+	entries, err := fs.ReadDir(l.t.FS, path.Clean(dir))
+	if errors.Is(err, fs.ErrNotExist) && dir == l.t.ObjectsSubdir {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fs.ReadDir(%s) : %v", dir, err)
+	}
+
+	claims := map[string][]string{}
+	folders := []string{}
+	for _, e := range entries {
+		rel := path.Join(dir, e.Name())
+		if e.IsDir() {
+			folders = append(folders, e.Name())
+			continue
+		}
+		o, ok := l.read(rel)
+		if !ok {
+			continue
+		}
+		l.object(rel, o)
+		if raw, ok := o.Get("ContainedObjects" + pathExt); ok {
+			if sub, ok := raw.(string); ok {
+				claims[sub] = append(claims[sub], rel)
+			}
+		}
+		if raw, ok := o.Get("ContainedObjects" + objects.OrderKey); ok {
+			sub, _ := o.String("ContainedObjects" + pathExt)
+			arr, _ := raw.([]interface{})
+			for _, v := range arr {
+				if name, ok := v.(string); ok && !l.exists(path.Join(dir, sub, name)) {
+					l.report(rel, MissingFile, "ContainedObjects%s lists %s, which doesn't exist", objects.OrderKey, path.Join(dir, sub, name))
+				}
+			}
+		}
+	}
+
+	for _, sub := range sortedKeys(claims) {
+		owners := claims[sub]
+		if len(owners) > 1 {
+			for _, owner := range owners {
+				l.report(owner, ClaimedTwice, "%s is also claimed by %s", path.Join(dir, sub), strings.Join(others(owners, owner), ", "))
+			}
+		}
+		if !l.exists(path.Join(dir, sub)) {
+			for _, owner := range owners {
+				l.report(owner, MissingFile, "ContainedObjects%s names %s, which doesn't exist", pathExt, path.Join(dir, sub))
+			}
+		}
+	}
+	for _, f := range folders {
+		rel := path.Join(dir, f)
+		if _, ok := claims[f]; !ok {
+			l.report(rel, UnclaimedDir, "no object in %s has \"ContainedObjects%s\": %q", dir, pathExt, f)
+		}
+		if err := l.objects(rel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *linter) object(rel string, o *ttsjson.Object) {
+	for _, k := range o.Keys() {
+		if !strings.HasSuffix(k, pathExt) {
+			continue
+		}
+		v, _ := o.Get(k)
+		name, ok := v.(string)
+		if !ok {
+			l.report(rel, NonStringPath, "%s is %v, not a file name", k, v)
+			continue
+		}
+		if k != "ContainedObjects"+pathExt {
+			l.script(rel, k, name)
+		}
+	}
+	objects.Walk([]interface{}{o}, func(obj *ttsjson.Object) {
+		who := "object"
+		if g, ok := obj.String("GUID"); ok {
+			who = "object " + g
+		}
+		for _, f := range requiredFields {
+			if _, ok := obj.Get(f); !ok {
+				l.report(rel, MissingField, "%s has no %s", who, f)
+			}
+		}
+		if _, ok := obj.Get("GUID"); ok {
+			if _, ok := obj.String("GUID"); !ok {
+				l.report(rel, MissingField, "%s has a GUID which isn't a string", who)
+			}
+		}
+		if s, ok := obj.String("LuaScript"); ok {
+			l.pending = append(l.pending, reference{from: rel, script: s})
+		}
+	})
+}
+
+// tests are used by the test runner rather than the mod.
+func (l *linter) tests() error {
+	root := path.Clean(l.t.TextSubdir)
+	err := fs.WalkDir(l.t.FS, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(p, testSuffix) {
+			l.use(p, relTo(root, p))
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// unused reports every file under dir missing from used.
+func (l *linter) unused(dir string, used map[string]bool) error {
+	root := path.Clean(dir)
+	err := fs.WalkDir(l.t.FS, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && !used[relTo(root, p)] {
+			l.report(p, UnusedFile, "nothing refers to this file")
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// relTo is the name of p, found walking from root, relative to root.
+func relTo(root, p string) string {
+	if root == "." {
+		return p
+	}
+	return strings.TrimPrefix(p, root+"/")
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func others(all []string, not string) []string {
+	o := []string{}
+	for _, a := range all {
+		if a != not {
+			o = append(o, a)
+		}
+	}
+	return o
+}
@@ -0,0 +1,88 @@
+package lint
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+// memTree holds files in memory, so lint reads no disk.
+func memTree(files map[string]string) fstest.MapFS {
+	m := fstest.MapFS{}
+	for name, content := range files {
+		m[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return m
+}
+
+func run(t *testing.T, files map[string]string) []Finding {
+	t.Helper()
+	found, err := Run(Tree{
+		FS:            memTree(files),
+		TextSubdir:    "src",
+		JSONSubdir:    "json",
+		ObjectsSubdir: "objects",
+		TextKeys:      []string{"LuaScript", "XmlUI"},
+		Modules:       []string{"generated/guids"},
+	})
+	if err != nil {
+		t.Fatalf("Run() : %v", err)
+	}
+	return found
+}
+
+func TestClean(t *testing.T) {
+	found := run(t, map[string]string{
+		"config.json":           `{"LuaScript_path": "Global.ttslua", "Grid_path": "grid.json", "ObjectStates_path": "objects"}`,
+		"json/grid.json":        `{}`,
+		"src/Global.ttslua":     "require(\"lib/util\")\nrequire(\"generated/guids\")\n",
+		"src/lib/util.ttslua":   `local cards = require("data/cards.json")`,
+		"src/data/cards.json":   `[]`,
+		"src/lib/board.ttslua":  ``,
+		"src/util_test.ttslua":  `require("lib/helper")`,
+		"src/lib/helper.ttslua": ``,
+		"objects/bag.json":      `{"GUID": "abc123", "Name": "Bag", "Transform": {}, "ContainedObjects_path": "bag", "LuaScript_path": "lib/board.ttslua"}`,
+		"objects/bag/card.json": `{"GUID": "def456", "Name": "Card", "Transform": {}}`,
+		"objects/board.json":    `{"GUID": "fed321", "Name": "Board", "Transform": {}, "LuaScript": "require(\"generated/guids\")"}`,
+	})
+	if len(found) != 0 {
+		t.Errorf("want no findings, got %v", found)
+	}
+}
+
+func TestFindings(t *testing.T) {
+	found := run(t, map[string]string{
+		"config.json":           `{"LuaScript_path": "Global.ttslua", "Grid_path": 3, "Lighting_path": "lighting.json"}`,
+		"json/unused.json":      `{}`,
+		"src/Global.ttslua":     `require("missing")`,
+		"src/orphan.ttslua":     ``,
+		"objects/a.json":        `{"GUID": "abc123", "Name": "Bag", "ContainedObjects_path": "shared"}`,
+		"objects/b.json":        `{"GUID": 5, "Name": "Bag", "Transform": {}, "ContainedObjects_path": "shared"}`,
+		"objects/c.json":        `{"GUID": "ccc333", "Name": "Bag", "Transform": {}, "ContainedObjects_path": "gone"}`,
+		"objects/bad.json":      `{"GUID": `,
+		"objects/shared/x.json": `{"GUID": "aaa111", "Name": "Card", "Transform": {}, "States": {"2": {"Name": "Card", "Transform": {}}}}`,
+		"objects/stray/y.json":  `{"GUID": "bbb222", "Name": "Card", "Transform": {}}`,
+	})
+	want := []Finding{
+		{"config.json", MissingFile, "Lighting_path names json/lighting.json, which doesn't exist"},
+		{"config.json", NonStringPath, "Grid_path is 3, not a file name"},
+		{"json/unused.json", UnusedFile, "nothing refers to this file"},
+		{"objects/a.json", ClaimedTwice, "objects/shared is also claimed by objects/b.json"},
+		{"objects/a.json", MissingField, "object abc123 has no Transform"},
+		{"objects/b.json", ClaimedTwice, "objects/shared is also claimed by objects/a.json"},
+		{"objects/b.json", MissingField, "object has a GUID which isn't a string"},
+		{"objects/bad.json", InvalidJSON, "EOF"},
+		{"objects/c.json", MissingFile, "ContainedObjects_path names objects/gone, which doesn't exist"},
+		{"objects/shared/x.json", MissingField, "object has no GUID"},
+		{"objects/stray", UnclaimedDir, "no object in objects has \"ContainedObjects_path\": \"stray\""},
+		{"src/Global.ttslua", MissingFile, "require names src/missing.ttslua, which doesn't exist"},
+		{"src/orphan.ttslua", UnusedFile, "nothing refers to this file"},
+	}
+	if len(found) != len(want) {
+		t.Fatalf("want %v findings, got %v:\n%v", len(want), len(found), found)
+	}
+	for i := range want {
+		if found[i] != want[i] {
+			t.Errorf("finding %v : want %v got %v", i, want[i], found[i])
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package luatest
+
+import (
+	"ModCreator/file"
+	"ModCreator/objects"
+	"ModCreator/ttsjson"
+	_ "embed" // for the mock TTS api
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	// TestSuffix marks lua files under src as tests.
+	TestSuffix = "_test.ttslua"
+	// TestPrefix marks global functions in a test file as test cases.
+	TestPrefix = "test"
+)
+
+var (
+	//go:embed mock.lua
+	mockAPI string
+)
+
+// Result is the outcome of a single test function.
+type Result struct {
+	File string
+	Name string
+	Err  error
+}
+
+func (r Result) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("FAIL %s %s : %v", r.File, r.Name, r.Err)
+	}
+	return fmt.Sprintf("ok   %s %s", r.File, r.Name)
+}
+
+// FindTests lists every test file in src, the text directory.
+func FindTests(src fs.FS) ([]string, error) {
+	tests := []string{}
+	err := fs.WalkDir(src, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(p, TestSuffix) {
+			tests = append(tests, p)
+		}
+		return nil
+	})
+	sort.Strings(tests)
+	return tests, err
+}
+
+// Runner runs lua test files against a mock of the TTS api.
+type Runner struct {
+	// Lua resolves requires the same way the build does.
+	Lua interface {
+		ExpandFile(string) (string, []file.Origin, error)
+	}
+	// Objects seed the mock table, usually the ObjectStates of the built mod.
+	Objects interface{}
+}
+
+// Run calls each test function of a test file in name order, each in a fresh
+// lua state holding the mock api and the test file, so tests can't see what
+// the others did.
+func (r *Runner) Run(filename string) ([]Result, error) {
+	script, origins, err := r.Lua.ExpandFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ExpandFile(%s) : %v", filename, err)
+	}
+	self := r.self(filename)
+
+	L, err := r.load(filename, script, origins, self)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	L.G.Global.ForEach(func(k, v lua.LValue) {
+		if s, ok := k.(lua.LString); ok && strings.HasPrefix(string(s), TestPrefix) && v.Type() == lua.LTFunction {
+			names = append(names, string(s))
+		}
+	})
+	L.Close()
+	sort.Strings(names)
+
+	results := []Result{}
+	for _, name := range names {
+		res := Result{File: filename, Name: name}
+		L, err := r.load(filename, script, origins, self)
+		if err != nil {
+			return nil, err
+		}
+		err = L.CallByParam(lua.P{Fn: L.GetGlobal(name), Protect: true})
+		if err != nil {
+			res.Err = fmt.Errorf("%s", translate(err.Error(), origins))
+		}
+		L.Close()
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// load starts a lua state with the mock api seeded with the objects, self
+// set to the object with the GUID self, or Global, and script run.
+func (r *Runner) load(filename, script string, origins []file.Origin, self string) (*lua.LState, error) {
+	L := lua.NewState()
+	L.SetGlobal("JSON", jsonModule(L))
+	if err := L.DoString(mockAPI); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("loading mock api : %v", err)
+	}
+	mock := L.GetGlobal("Mock").(*lua.LTable)
+	seed := L.NewTable()
+	for _, raw := range asArray(r.Objects) {
+		if obj, ok := raw.(*ttsjson.Object); ok {
+			seed.Append(seedObject(L, obj))
+		}
+	}
+	if err := L.CallByParam(lua.P{Fn: L.GetField(mock, "seed"), Protect: true}, seed); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("seeding mock objects : %v", err)
+	}
+	if err := L.CallByParam(lua.P{Fn: L.GetField(mock, "setSelf"), Protect: true}, lua.LString(self)); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("setting self : %v", err)
+	}
+
+	fn, err := L.LoadString(script)
+	if err != nil {
+		L.Close()
+		return nil, fmt.Errorf("loading %s : %v", filename, translate(err.Error(), origins))
+	}
+	L.Push(fn)
+	if err := L.PCall(0, lua.MultRet, nil); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("running %s : %v", filename, translate(err.Error(), origins))
+	}
+	return L, nil
+}
+
+// self is the GUID of the object whose script a test file tests: X_test.ttslua
+// tests the object whose script is built from X.ttslua. It is empty for a test
+// of Global, or of a library no object's script is.
+func (r *Runner) self(filename string) string {
+	tested, _, err := r.Lua.ExpandFile(strings.TrimSuffix(filename, TestSuffix) + ".ttslua")
+	if err != nil || tested == "" {
+		return ""
+	}
+	guid := ""
+	objects.Walk(r.Objects, func(o *ttsjson.Object) {
+		if s, _ := o.String("LuaScript"); guid == "" && s == tested {
+			guid, _ = o.String("GUID")
+		}
+	})
+	return guid
+}
+
+// seedObject describes an object of the built mod to the mock api.
+func seedObject(L *lua.LState, o *ttsjson.Object) *lua.LTable {
+	t := L.NewTable()
+	fields := map[string]string{
+		"GUID":           "guid",
+		"Name":           "name",
+		"Nickname":       "nickname",
+		"Description":    "description",
+		"GMNotes":        "gmnotes",
+		"LuaScript":      "script_code",
+		"LuaScriptState": "script_state",
+	}
+	for from, to := range fields {
+		if s, ok := o.String(from); ok {
+			t.RawSetString(to, lua.LString(s))
+		}
+	}
+	if rawLocked, ok := o.Get("Locked"); ok {
+		if locked, ok := rawLocked.(bool); ok {
+			t.RawSetString("locked", lua.LBool(locked))
+		}
+	}
+	if tags, ok := o.Array("Tags"); ok {
+		t.RawSetString("tags", toLua(L, tags))
+	}
+	if tr, ok := o.Object("Transform"); ok {
+		t.RawSetString("position", vector(L, tr, "posX", "posY", "posZ"))
+		t.RawSetString("rotation", vector(L, tr, "rotX", "rotY", "rotZ"))
+	}
+	contained := L.NewTable()
+	subs, _ := o.Get("ContainedObjects")
+	for _, raw := range asArray(subs) {
+		if sub, ok := raw.(*ttsjson.Object); ok {
+			contained.Append(seedObject(L, sub))
+		}
+	}
+	t.RawSetString("contained", contained)
+	return t
+}
+
+func asArray(v interface{}) []interface{} {
+	arr, _ := v.([]interface{})
+	return arr
+}
+
+func vector(L *lua.LState, tr *ttsjson.Object, x, y, z string) *lua.LTable {
+	t := L.NewTable()
+	for _, k := range []string{x, y, z} {
+		var f float64
+		v, _ := tr.Get(k)
+		switch n := v.(type) {
+		case json.Number:
+			f, _ = n.Float64()
+		case float64:
+			f = n
+		}
+		t.RawSetString(strings.ToLower(k[len(k)-1:]), lua.LNumber(f))
+	}
+	return t
+}
+
+var chunkLine = regexp.MustCompile(`<string>:(\d+):`)
+
+// translate points line numbers in lua errors at the source files they came
+// from.
+func translate(msg string, origins []file.Origin) string {
+	return chunkLine.ReplaceAllStringFunc(msg, func(m string) string {
+		n, err := strconv.Atoi(chunkLine.FindStringSubmatch(m)[1])
+		if err != nil || n < 1 || n > len(origins) || origins[n-1].File == "" {
+			return m
+		}
+		return fmt.Sprintf("%s:%v:", origins[n-1].File, origins[n-1].Line)
+	})
+}
+
+// jsonModule provides the JSON.encode and JSON.decode functions TTS offers.
+func jsonModule(L *lua.LState) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("encode", L.NewFunction(func(L *lua.LState) int {
+		b, err := json.Marshal(fromLua(L.CheckAny(1)))
+		if err != nil {
+			L.RaiseError("JSON.encode : %v", err)
+		}
+		L.Push(lua.LString(b))
+		return 1
+	}))
+	t.RawSetString("decode", L.NewFunction(func(L *lua.LState) int {
+		var v interface{}
+		if err := json.Unmarshal([]byte(L.CheckString(1)), &v); err != nil {
+			L.RaiseError("JSON.decode : %v", err)
+		}
+		L.Push(toLua(L, v))
+		return 1
+	}))
+	return t
+}
+
+func toLua(L *lua.LState, v interface{}) lua.LValue {
+	switch val := v.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(val)
+	case float64:
+		return lua.LNumber(val)
+	case string:
+		return lua.LString(val)
+	case []interface{}:
+		t := L.NewTable()
+		for _, e := range val {
+			t.Append(toLua(L, e))
+		}
+		return t
+	case map[string]interface{}:
+		t := L.NewTable()
+		for k, e := range val {
+			t.RawSetString(k, toLua(L, e))
+		}
+		return t
+	}
+	return lua.LString(fmt.Sprint(v))
+}
+
+func fromLua(v lua.LValue) interface{} {
+	switch val := v.(type) {
+	case lua.LBool:
+		return bool(val)
+	case lua.LNumber:
+		return float64(val)
+	case lua.LString:
+		return string(val)
+	case *lua.LTable:
+		if n := val.Len(); n > 0 {
+			arr := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				arr = append(arr, fromLua(val.RawGetInt(i)))
+			}
+			return arr
+		}
+		m := map[string]interface{}{}
+		val.ForEach(func(k, e lua.LValue) {
+			m[k.String()] = fromLua(e)
+		})
+		return m
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package luatest
+
+import (
+	"ModCreator/file"
+	"ModCreator/ttsjson"
+	"fmt"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+type fakeLua map[string]string
+
+func (f fakeLua) ExpandFile(s string) (string, []file.Origin, error) {
+	if script, ok := f[s]; ok {
+		return script, nil, nil
+	}
+	return "", nil, fmt.Errorf("fake file %s not found", s)
+}
+
+func TestRun(t *testing.T) {
+	r := &Runner{
+		Lua: fakeLua{"board_test.ttslua": `
+function testSeeded()
+  local board = getObjectFromGUID("abc123")
+  assert(board.getName() == "Main Board")
+  assert(board:hasTag("Board"))
+  assert(board.getPosition().y == 2)
+  local card = board.takeObject({guid = "def456"})
+  assert(card.getName() == "Ace")
+  assert(board.getQuantity() == -1)
+end
+
+function testBroken()
+  error("broken")
+end
+
+function helper() end
+`},
+		Objects: ttsjson.Convert([]map[string]interface{}{
+			{
+				"GUID":      "abc123",
+				"Name":      "Custom_Board",
+				"Nickname":  "Main Board",
+				"Tags":      []interface{}{"Board"},
+				"Transform": map[string]interface{}{"posX": 1.0, "posY": 2.0, "posZ": 3.0},
+				"ContainedObjects": []interface{}{
+					map[string]interface{}{"GUID": "def456", "Name": "Card", "Nickname": "Ace"},
+				},
+			},
+		}),
+	}
+
+	results, err := r.Run("board_test.ttslua")
+	if err != nil {
+		t.Fatalf("Run() : %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("want 2 results, got %v", results)
+	}
+	if results[0].Name != "testBroken" || results[0].Err == nil {
+		t.Errorf("want testBroken to fail, got %v", results[0])
+	}
+	if results[1].Name != "testSeeded" || results[1].Err != nil {
+		t.Errorf("want testSeeded to pass, got %v", results[1])
+	}
+}
+
+func TestRunIsolated(t *testing.T) {
+	board := `function onLoad() self.setName("Loaded") end`
+	r := &Runner{
+		Lua: fakeLua{
+			"board.ttslua": board,
+			"board_test.ttslua": board + `
+function testA()
+  onLoad()
+  assert(self.getName() == "Loaded")
+  count = (count or 0) + 1
+  getObjectFromGUID("abc123").destruct()
+end
+
+function testB()
+  assert(count == nil)
+  assert(self.getName() == "Main Board")
+  assert(getObjectFromGUID("abc123") == self)
+end
+`,
+			"global_test.ttslua": `
+function testGlobal()
+  assert(self == Global)
+end
+`,
+		},
+		Objects: ttsjson.Convert([]map[string]interface{}{
+			{"GUID": "abc123", "Name": "Custom_Board", "Nickname": "Main Board", "LuaScript": board},
+		}),
+	}
+	for _, f := range []string{"board_test.ttslua", "global_test.ttslua"} {
+		results, err := r.Run(f)
+		if err != nil {
+			t.Fatalf("Run(%s) : %v", f, err)
+		}
+		for _, res := range results {
+			if res.Err != nil {
+				t.Errorf("want %s to pass, got %v", res.Name, res.Err)
+			}
+		}
+	}
+}
+
+func TestFindTests(t *testing.T) {
+	src := fstest.MapFS{
+		"board_test.ttslua":    {},
+		"board.ttslua":         {},
+		"lib/util_test.ttslua": {},
+	}
+	got, err := FindTests(src)
+	if err != nil {
+		t.Fatalf("FindTests() : %v", err)
+	}
+	if want := []string{"board_test.ttslua", "lib/util_test.ttslua"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
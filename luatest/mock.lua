@@ -0,0 +1,307 @@
+-- A scriptable stand in for the parts of the Tabletop Simulator API that game
+-- scripts use. Tests may replace any of these functions, and inspect Mock to
+-- see what scripts did.
+Mock = {
+  objects = {},
+  broadcasts = {},
+  waits = {},
+  nextWait = 1,
+}
+
+local Object = {}
+
+-- TTS lets scripts call object methods as obj.method() or obj:method(), so
+-- every method is bound to its object.
+local function bind(o)
+  for name, impl in pairs(Object) do
+    o[name] = function(first, ...)
+      if first == o then
+        return impl(o, ...)
+      end
+      return impl(o, first, ...)
+    end
+  end
+  return o
+end
+
+local function vector(t)
+  t = t or {}
+  local x = t.x or t[1] or 0
+  local y = t.y or t[2] or 0
+  local z = t.z or t[3] or 0
+  return {x = x, y = y, z = z, x, y, z}
+end
+
+local function copy(t)
+  local c = {}
+  for k, v in pairs(t or {}) do
+    c[k] = v
+  end
+  return c
+end
+
+local function newObject(data)
+  local o = {
+    guid = data.guid,
+    type = data.name,
+    name = data.nickname or "",
+    description = data.description or "",
+    gm_notes = data.gmnotes or "",
+    tags = copy(data.tags),
+    position = vector(data.position),
+    rotation = vector(data.rotation),
+    script_state = data.script_state or "",
+    script_code = data.script_code or "",
+    locked = data.locked or false,
+    vars = {},
+    buttons = {},
+    contents = {},
+  }
+  for _, sub in ipairs(data.contained or {}) do
+    table.insert(o.contents, newObject(sub))
+  end
+  return bind(o)
+end
+
+-- Mock.addObject puts an object on the table. data may have guid, name,
+-- nickname, description, gmnotes, tags, position, rotation, script_state,
+-- script_code, locked and contained fields.
+function Mock.addObject(data)
+  local o = newObject(data)
+  Mock.objects[o.guid] = o
+  return o
+end
+
+-- Mock.seed puts every object of a built mod on the table.
+function Mock.seed(objects)
+  for _, data in ipairs(objects) do
+    Mock.addObject(data)
+  end
+end
+
+-- Mock.setSelf makes self the object with the given GUID, as it is for that
+-- object's script in TTS, or Global when there is no such object.
+function Mock.setSelf(guid)
+  self = Mock.objects[guid] or Global
+end
+
+-- Mock.runWaits runs pending Wait callbacks until none are ready.
+function Mock.runWaits()
+  local progress = true
+  while progress do
+    progress = false
+    local ids = {}
+    for id in pairs(Mock.waits) do
+      table.insert(ids, id)
+    end
+    table.sort(ids)
+    for _, id in ipairs(ids) do
+      local w = Mock.waits[id]
+      if w ~= nil and (w.condition == nil or w.condition()) then
+        Mock.waits[id] = nil
+        w.fn()
+        progress = true
+      end
+    end
+  end
+end
+
+function Object:getGUID() return self.guid end
+function Object:getName() return self.name end
+function Object:setName(name) self.name = name return true end
+function Object:getDescription() return self.description end
+function Object:setDescription(d) self.description = d return true end
+function Object:getGMNotes() return self.gm_notes end
+function Object:setGMNotes(n) self.gm_notes = n return true end
+function Object:getPosition() return vector(self.position) end
+function Object:setPosition(p) self.position = vector(p) return true end
+function Object:setPositionSmooth(p) self.position = vector(p) return true end
+function Object:getRotation() return vector(self.rotation) end
+function Object:setRotation(r) self.rotation = vector(r) return true end
+function Object:setRotationSmooth(r) self.rotation = vector(r) return true end
+function Object:getLock() return self.locked end
+function Object:setLock(l) self.locked = l return true end
+function Object:getLuaScript() return self.script_code end
+function Object:setLuaScript(s) self.script_code = s return true end
+function Object:getVar(k) return self.vars[k] end
+function Object:setVar(k, v) self.vars[k] = v return true end
+function Object:getTable(k) return self.vars[k] end
+function Object:setTable(k, v) self.vars[k] = v return true end
+function Object:getTags() return copy(self.tags) end
+function Object:setTags(t) self.tags = copy(t) return true end
+function Object:getQuantity()
+  if #self.contents == 0 then return -1 end
+  return #self.contents
+end
+
+function Object:call(name, params)
+  local fn = self.vars[name]
+  if type(fn) ~= "function" then
+    error("object " .. self.guid .. " has no function " .. tostring(name))
+  end
+  return fn(params)
+end
+
+function Object:hasTag(tag)
+  for _, t in ipairs(self.tags) do
+    if t == tag then return true end
+  end
+  return false
+end
+
+function Object:addTag(tag)
+  if self:hasTag(tag) then return false end
+  table.insert(self.tags, tag)
+  return true
+end
+
+function Object:removeTag(tag)
+  for i, t in ipairs(self.tags) do
+    if t == tag then
+      table.remove(self.tags, i)
+      return true
+    end
+  end
+  return false
+end
+
+function Object:getObjects()
+  local list = {}
+  for i, o in ipairs(self.contents) do
+    table.insert(list, {guid = o.guid, name = o.name, description = o.description, gm_notes = o.gm_notes, tags = copy(o.tags), index = i - 1})
+  end
+  return list
+end
+
+function Object:takeObject(params)
+  params = params or {}
+  for i, o in ipairs(self.contents) do
+    if (params.guid == nil and (params.index == nil or params.index == i - 1)) or params.guid == o.guid then
+      table.remove(self.contents, i)
+      if params.position ~= nil then
+        o.position = vector(params.position)
+      end
+      Mock.objects[o.guid] = o
+      if params.callback_function ~= nil then
+        params.callback_function(o)
+      end
+      return o
+    end
+  end
+  return nil
+end
+
+function Object:putObject(o)
+  Mock.objects[o.guid] = nil
+  table.insert(self.contents, o)
+  return self
+end
+
+function Object:destruct()
+  Mock.objects[self.guid] = nil
+  return true
+end
+
+function Object:createButton(params) table.insert(self.buttons, copy(params)) return true end
+function Object:getButtons() return self.buttons end
+function Object:clearButtons() self.buttons = {} return true end
+function Object:editButton(params)
+  local b = self.buttons[(params.index or 0) + 1]
+  if b == nil then return false end
+  for k, v in pairs(params) do b[k] = v end
+  return true
+end
+function Object:removeButton(index)
+  return table.remove(self.buttons, index + 1) ~= nil
+end
+
+Global = {
+  guid = "-1",
+  getVar = function(k) return _G[k] end,
+  setVar = function(k, v) _G[k] = v return true end,
+  getTable = function(k) return _G[k] end,
+  setTable = function(k, v) _G[k] = v return true end,
+  call = function(name, params)
+    local fn = _G[name]
+    if type(fn) ~= "function" then
+      error("Global has no function " .. tostring(name))
+    end
+    return fn(params)
+  end,
+}
+
+function getObjectFromGUID(guid)
+  return Mock.objects[guid]
+end
+
+function getObjects()
+  local list = {}
+  for _, o in pairs(Mock.objects) do
+    table.insert(list, o)
+  end
+  table.sort(list, function(a, b) return a.guid < b.guid end)
+  return list
+end
+getAllObjects = getObjects
+
+function getObjectsWithTag(tag)
+  return getObjectsWithAnyTags({tag})
+end
+
+function getObjectsWithAnyTags(tags)
+  local list = {}
+  for _, o in ipairs(getObjects()) do
+    for _, t in ipairs(tags) do
+      if o:hasTag(t) then
+        table.insert(list, o)
+        break
+      end
+    end
+  end
+  return list
+end
+
+function getObjectsWithAllTags(tags)
+  local list = {}
+  for _, o in ipairs(getObjects()) do
+    local all = true
+    for _, t in ipairs(tags) do
+      all = all and o:hasTag(t)
+    end
+    if all then
+      table.insert(list, o)
+    end
+  end
+  return list
+end
+
+function broadcastToAll(message, color)
+  table.insert(Mock.broadcasts, {message = message, color = color})
+end
+
+function broadcastToColor(message, player_color, color)
+  table.insert(Mock.broadcasts, {message = message, color = color, player = player_color})
+end
+
+function printToAll(message, color)
+  table.insert(Mock.broadcasts, {message = message, color = color})
+end
+
+function printToColor(message, player_color, color)
+  table.insert(Mock.broadcasts, {message = message, color = color, player = player_color})
+end
+
+local function addWait(w)
+  local id = Mock.nextWait
+  Mock.nextWait = id + 1
+  Mock.waits[id] = w
+  return id
+end
+
+Wait = {
+  time = function(fn, seconds, repetitions) return addWait({fn = fn}) end,
+  frames = function(fn, count) return addWait({fn = fn}) end,
+  condition = function(fn, condition) return addWait({fn = fn, condition = condition}) end,
+  stop = function(id) Mock.waits[id] = nil end,
+  stopAll = function() Mock.waits = {} end,
+}
@@ -1,220 +1,753 @@
 package main
 
 import (
-	file "ModCreator/file"
+	"ModCreator/buildinfo"
+	"ModCreator/deps"
+	"ModCreator/file"
+	"ModCreator/format"
+	"ModCreator/guids"
+	"ModCreator/lint"
+	"ModCreator/luatest"
+	"ModCreator/modcreator"
 	objects "ModCreator/objects"
-	"ModCreator/reverse"
+	"ModCreator/regui"
+	"ModCreator/saves"
+	"ModCreator/scan"
+	"ModCreator/selector"
+	"ModCreator/sourcemap"
+	"ModCreator/ttsjson"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 var (
-	config  = flag.String("config", "testdata/simple", "a directory containing tts mod configs")
-	rev     = flag.Bool("reverse", false, "Instead of building a json from file structure, build file structure from json.")
-	modfile = flag.String("ttsmodfile", "", "where to read from when reversing.")
-
-	expectedStr       = []string{"SaveName", "Date", "VersionNumber", "GameMode", "GameType", "GameComplexity", "Table", "Sky", "Note", "LuaScript", "LuaScriptState", "XmlUI"}
-	expectedObj       = []string{"TabStates", "MusicPlayer", "Grid", "Lighting", "Hands", "ComponentTags", "Turns"}
-	expectedObjArr    = []string{"CameraStates", "DecalPallet", "CustomUIAssets", "SnapPoints"}
-	expectedObjStates = "ObjectStates"
+	config      = flag.String("config", "testdata/simple", "a directory containing tts mod configs")
+	rev         = flag.Bool("reverse", false, "Instead of building a json from file structure, build file structure from json.")
+	modfile     = flag.String("ttsmodfile", "", "where to read from when reversing.")
+	strictGUIDs = flag.Bool("strictguids", false, "Fail the build when a script references a GUID no object has.")
+	clean       = flag.Bool("clean", false, "Strip known malicious script payloads when scanning or reversing a mod.")
+	defines     = flag.String("define", "", "Comma separated preprocessor symbols to define for --#if blocks in scripts.")
+	buildTime   = flag.String("buildtime", "", "Pin the build time for reproducible builds: RFC3339, seconds since the epoch, or \"commit\" for the time of the current git commit. Defaults to $SOURCE_DATE_EPOCH, then now.")
+	policyFile  = flag.String("policy", "", "A file deciding which values reversing writes to files of their own. Defaults to extract.json in the config directory, if there is one.")
+	naming      = flag.String("naming", "Name", "When reversing, the object fields to name new object files after, in order of preference, like Nickname,Name,GUID.")
+	out         = flag.String("out", "", "Where to write the built mod: a file, - for stdout, or a TTS Saves directory. Defaults to output.json in the config directory.")
+	saveName    = flag.String("savename", "", "When --out is a Saves directory, the file to write there instead of the next free TS_Save_N.json.")
+	emmyLua     = flag.Bool("emmylua", false, "Also write the generated GUID module, with EmmyLua annotations, into the src directory for editors.")
 )
 
 const (
-	textSubdir    = "src"
-	jsonSubdir    = "json"
-	objectsSubdir = "objects"
-)
-
-// Config is how users will specify their mod's configuration.
-type Config struct {
-	Raw Obj `json:"-"`
-}
+	textSubdir    = modcreator.TextSubdir
+	jsonSubdir    = modcreator.JSONSubdir
+	objectsSubdir = modcreator.ObjectsSubdir
 
-// Obj is a simpler way to refer to a json map.
-type Obj map[string]interface{}
-
-// ObjArray is a simple way to refer to an array of json maps
-type ObjArray []map[string]interface{}
-
-// Mod is used as the accurate representation of what gets printed when
-// module creation is done
-type Mod struct {
-	Data Obj
-}
+	sourceMapFile = "output.map.json"
+	syncStateFile = ".sync.json"
+)
 
 func main() {
 	flag.Parse()
-
-	lua := file.NewLuaOps(path.Join(*config, textSubdir))
-	j := file.NewJSONOps(path.Join(*config, jsonSubdir))
-
-	if *rev {
-		raw, err := prepForReverse(*config, *modfile)
-		if err != nil {
-			log.Fatalf("prepForReverse (%s) failed : %v", *modfile, err)
+	ctx := context.Background()
+
+	switch flag.Arg(0) {
+	case "":
+		// no command means build, or reverse if requested.
+	case "regui":
+		if err := runRegui(*config, flag.Args()[1:]); err != nil {
+			log.Fatalf("regui : %v", err)
 		}
-		err = reverse.Write(raw, lua, j, *config, expectedStr, expectedObj, expectedObjArr)
-		if err != nil {
-			log.Fatalf("reverse.Write(<%s>) failed : %v", *modfile, err)
+		return
+	case "locate":
+		if err := runLocate(*config, flag.Args()[1:]); err != nil {
+			log.Fatalf("locate : %v", err)
+		}
+		return
+	case "test":
+		if err := runTests(ctx, *config, flag.Args()[1:]); err != nil {
+			log.Fatalf("test : %v", err)
+		}
+		return
+	case "fmt":
+		if err := runFmt(*config, flag.Args()[1:]); err != nil {
+			log.Fatalf("fmt : %v", err)
+		}
+		return
+	case "deps":
+		if err := runDeps(ctx, *config, flag.Args()[1:]); err != nil {
+			log.Fatalf("deps : %v", err)
+		}
+		return
+	case "lint":
+		if err := runLint(*config, flag.Args()[1:]); err != nil {
+			log.Fatalf("lint : %v", err)
+		}
+		return
+	case "export-object":
+		if err := runExportObject(ctx, *config, *out, flag.Args()[1:]); err != nil {
+			log.Fatalf("export-object : %v", err)
 		}
 		return
+	case "import-object":
+		if err := runImportObject(ctx, *config, flag.Args()[1:]); err != nil {
+			log.Fatalf("import-object : %v", err)
+		}
+		return
+	case "import":
+		if err := runImport(ctx, *config, flag.Args()[1:]); err != nil {
+			log.Fatalf("import : %v", err)
+		}
+		return
+	case "extract":
+		if err := runExtract(ctx, *config, *out, flag.Args()[1:]); err != nil {
+			log.Fatalf("extract : %v", err)
+		}
+		return
+	case "sync":
+		if err := runSync(ctx, *config, *modfile, flag.Args()[1:]); err != nil {
+			log.Fatalf("sync : %v", err)
+		}
+		return
+	case "scan":
+		if err := runScan(*modfile, *clean); err != nil {
+			log.Fatalf("scan : %v", err)
+		}
+		return
+	default:
+		log.Fatalf("unknown command %s", flag.Arg(0))
 	}
 
-	c, err := readConfig(*config)
-	if err != nil {
-		fmt.Printf("readConfig(%s) : %v\n", *config, err)
+	if *rev {
+		if err := runReverse(ctx, *config, *modfile); err != nil {
+			log.Fatalf("reverse (%s) failed : %v", *modfile, err)
+		}
 		return
 	}
 
-	m, err := generateMod(*config, lua, j, c)
+	m, err := modcreator.Build(ctx, options(*config))
 	if err != nil {
-		fmt.Printf("generateMod(<config>) : %v\n", err)
+		fmt.Printf("modcreator.Build(%s) : %v\n", *config, err)
 		return
 	}
-	err = printMod(*config, m)
+	unknown := guids.Lint(m.Data, m.Origins)
+	for _, u := range unknown {
+		if u.File != "" {
+			u.File = path.Join(textSubdir, u.File)
+		}
+		log.Println(u)
+	}
+	if *strictGUIDs && len(unknown) > 0 {
+		log.Fatalf("%v scripts reference unknown GUIDs", len(unknown))
+	}
+	err = printMod(*config, *out, m)
 	if err != nil {
 		log.Fatalf("printMod(...) : %v", err)
 	}
+	sm := sourcemap.Build(m.Data, m.Origins, textSubdir)
+	err = sm.Write(path.Join(*config, sourceMapFile))
+	if err != nil {
+		log.Fatalf("sourcemap.Write(...) : %v", err)
+	}
 }
 
-func readConfig(cPath string) (*Config, error) {
-	// Open our jsonFile
-	cFile, err := os.Open(path.Join(cPath, "config.json"))
-	// if we os.Open returns an error then handle it
+// options are the modcreator options the flags give for the config
+// directory cPath.
+func options(cPath string) modcreator.Options {
+	return modcreator.Options{
+		Dir:        cPath,
+		FS:         file.DirFS(cPath),
+		Defines:    strings.Split(*defines, ","),
+		BuildTime:  *buildTime,
+		Annotate:   *emmyLua,
+		PolicyFile: *policyFile,
+	}
+}
+
+// runReverse writes the mod file modfile into the config directory cPath,
+// printing any names it couldn't keep.
+func runReverse(ctx context.Context, cPath, modfile string) error {
+	m, err := modcreator.ReadMod(modfile)
+	if err != nil {
+		return err
+	}
+	checkScripts(m.Data, *clean)
+	opts := options(cPath)
+	opts.Naming, err = objects.ParseNaming(*naming)
 	if err != nil {
-		return nil, fmt.Errorf("os.Open(%s): %v", path.Join(cPath, "config.json"), err)
+		return fmt.Errorf("--naming : %v", err)
 	}
-	// defer the closing of our jsonFile so that we can parse it later on
-	defer cFile.Close()
+	err = modcreator.Reverse(ctx, m, opts)
+	var conflicts *modcreator.ConflictError
+	if errors.As(err, &conflicts) {
+		for _, c := range conflicts.Conflicts {
+			fmt.Printf("conflict: %v\n", c)
+		}
+		return nil
+	}
+	return err
+}
 
-	b, err := ioutil.ReadAll(cFile)
+// runExportObject builds one object of the config directory cPath, selected by
+// GUID or path, as a TTS Saved Object written to out: a file, a Saved Objects
+// directory, or stdout when empty or -.
+func runExportObject(ctx context.Context, cPath, out string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a GUID or object file to export")
+	}
+	m, err := modcreator.ExportObject(ctx, options(cPath), args[0])
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(out); err == nil && fi.IsDir() {
+		objs, _ := saves.Objects(m.Data)
+		name := *saveName
+		if name == "" {
+			name = objectName(objs[0])
+		}
+		f, err := saves.Write(out, name, m.Data, m.Info.Time, configImage(cPath))
+		if err != nil {
+			return err
+		}
+		log.Printf("saved %s", f)
+		return nil
+	}
+	b, err := ttsjson.Marshal(m.Data)
 	if err != nil {
-		return nil, fmt.Errorf("ioutil.Readall(%s) : %v", path.Join(cPath, "config.json"), err)
+		return fmt.Errorf("ttsjson.Marshal(<object>) : %v", err)
+	}
+	if out == "" || out == "-" {
+		_, err = os.Stdout.Write(b)
+		return err
 	}
-	var c Config
+	return saves.WriteFile(out, b)
+}
 
-	err = json.Unmarshal(b, &c.Raw)
+// objectName is what TTS would call a Saved Object file of o: its Nickname,
+// or failing that its Name.
+func objectName(o *ttsjson.Object) string {
+	name, _ := o.String("Nickname")
+	if strings.TrimSpace(name) == "" {
+		name, _ = o.String("Name")
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < ' ' {
+			return -1
+		}
+		return r
+	}, name)
+}
+
+// configImage is the thumbnail the ImagePath of the config directory cPath
+// names, if any.
+func configImage(cPath string) string {
+	c, err := modcreator.ReadMod(path.Join(cPath, modcreator.ConfigFile))
 	if err != nil {
-		return nil, fmt.Errorf("json.Unmarshal(%s) : %v", b, err)
+		return ""
 	}
-	return &c, nil
+	return imagePath(cPath, c.Data)
 }
 
-func generateMod(p string, lua file.LuaReader, j file.JSONReader, c *Config) (*Mod, error) {
-	if c == nil {
-		return nil, fmt.Errorf("nil config")
+// imagePath is the file the ImagePath of data names, relative to the config
+// directory cPath, or empty if it names none.
+func imagePath(cPath string, data *ttsjson.Object) string {
+	i, ok := data.String("ImagePath")
+	if !ok || i == "" {
+		return ""
+	}
+	if !filepath.IsAbs(i) {
+		i = filepath.Join(cPath, i)
 	}
-	var m Mod
+	return i
+}
 
-	m.Data = c.Raw
+// runImportObject reverses a Saved Object file into the config directory
+// cPath, at the top of the objects folder or into the folder or container
+// given, printing the files written and any GUIDs which had to change.
+func runImportObject(ctx context.Context, cPath string, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("expected a Saved Object file, and optionally where in the objects folder to put it")
+	}
+	m, err := modcreator.ReadMod(args[0])
+	if err != nil {
+		return err
+	}
+	checkScripts(m.Data, *clean)
+	into := ""
+	if len(args) == 2 {
+		into = args[1]
+	}
+	opts := options(cPath)
+	opts.Naming, err = objects.ParseNaming(*naming)
+	if err != nil {
+		return fmt.Errorf("--naming : %v", err)
+	}
+	imported, err := modcreator.ImportObject(ctx, m.Data, into, opts)
+	return printImported(imported, err)
+}
 
-	plainObj := func(s string) (interface{}, error) {
-		return j.ReadObj(s)
+// runImport reverses the objects of another mod file which a selector picks
+// into the config directory cPath, reporting the assets and tags they bring.
+func runImport(ctx context.Context, cPath string, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	into := flags.String("into", "", "Where in the objects folder to put the objects: a folder, or a container by path or GUID. Defaults to the top.")
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		return fmt.Errorf("expected a mod file, then the GUIDs, name:<name> or tag:<tag> of the objects to import")
+	}
+	sel, err := selector.Parse(flags.Args()[1:])
+	if err != nil {
+		return err
+	}
+	m, err := modcreator.ReadMod(flags.Arg(0))
+	if err != nil {
+		return err
 	}
-	objArray := func(s string) (interface{}, error) {
-		return j.ReadObjArray(s)
+	checkScripts(m.Data, *clean)
+	opts := options(cPath)
+	opts.Naming, err = objects.ParseNaming(*naming)
+	if err != nil {
+		return fmt.Errorf("--naming : %v", err)
+	}
+	imported, err := modcreator.Import(ctx, m, sel, *into, opts)
+	if err := printImported(imported, err); err != nil {
+		return err
+	}
+	for _, a := range imported.Assets {
+		fmt.Printf("asset: %s\n", a)
 	}
-	luaGet := func(s string) (interface{}, error) {
-		return lua.EncodeFromFile(s)
+	newTags := map[string]bool{}
+	for _, t := range imported.NewTags {
+		newTags[t] = true
+	}
+	for _, t := range imported.Tags {
+		if newTags[t] {
+			fmt.Printf("tag: %s (not in ComponentTags)\n", t)
+		} else {
+			fmt.Printf("tag: %s\n", t)
+		}
 	}
+	return nil
+}
 
-	ext := "_path"
-	for _, stringbased := range expectedStr {
-		tryPut(&m.Data, stringbased+ext, stringbased, luaGet)
+// runExtract builds a mod of only the objects args select, written to out
+// like a build, or to output.min.json in the config directory.
+func runExtract(ctx context.Context, cPath, out string, args []string) error {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	stub := flags.Bool("stubglobal", false, "Replace Global's script with a stub, and drop its saved state and UI.")
+	refs := flags.Bool("refs", false, "Also keep the objects the kept objects' scripts get by getObjectFromGUID.")
+	flags.Parse(args)
+	sel, err := selector.Parse(flags.Args())
+	if err != nil {
+		return err
+	}
+	m, err := modcreator.Extract(ctx, options(cPath), sel, modcreator.ExtractOptions{StubGlobal: *stub, Referenced: *refs})
+	if err != nil {
+		return err
+	}
+	objs, _ := m.Data.Array("ObjectStates")
+	log.Printf("extracted %v objects", len(objs))
+	if out == "" {
+		out = path.Join(cPath, "output.min.json")
 	}
+	return printMod(cPath, out, m)
+}
 
-	for _, objbased := range expectedObj {
-		tryPut(&m.Data, objbased+ext, objbased, plainObj)
+// printImported prints the files an import wrote, any GUIDs which had to
+// change and any names which couldn't be kept.
+func printImported(imported *modcreator.Imported, err error) error {
+	var conflicts *modcreator.ConflictError
+	if errors.As(err, &conflicts) {
+		for _, c := range conflicts.Conflicts {
+			fmt.Printf("conflict: %v\n", c)
+		}
+	} else if err != nil {
+		return err
+	}
+	for _, c := range imported.Changes {
+		fmt.Printf("GUID %s is now %s\n", c.Old, c.New)
+	}
+	for _, f := range imported.Files {
+		fmt.Println(path.Join(objectsSubdir, f))
 	}
+	return nil
+}
 
-	for _, objarraybased := range expectedObjArr {
-		tryPut(&m.Data, objarraybased+ext, objarraybased, objArray)
+// runSync watches the save file modfile, reversing it into the config
+// directory cPath each time TTS writes it, and printing the objects which
+// changed. A sync is refused while the config directory has changes the last
+// sync didn't make.
+func runSync(ctx context.Context, cPath, modfile string, args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	interval := flags.Duration("interval", time.Second, "How often to check the save file for changes.")
+	once := flags.Bool("once", false, "Sync the save file once, then exit.")
+	force := flags.Bool("force", false, "Sync the first time even though the config directory changed since the last sync, overwriting those changes.")
+	flags.Parse(args)
+
+	if modfile == "" {
+		return fmt.Errorf("--ttsmodfile names the save file to sync")
+	}
+	opts := options(cPath)
+	var err error
+	opts.Naming, err = objects.ParseNaming(*naming)
+	if err != nil {
+		return fmt.Errorf("--naming : %v", err)
+	}
+	stateFile := path.Join(cPath, syncStateFile)
+	var state modcreator.SyncState
+	if b, err := ioutil.ReadFile(stateFile); err == nil {
+		if err := json.Unmarshal(b, &state); err != nil {
+			return fmt.Errorf("json.Unmarshal(%s) : %v", stateFile, err)
+		}
+	}
+	s, err := modcreator.NewSyncer(opts, state)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		if err := writeSyncState(stateFile, s.State()); err != nil {
+			return err
+		}
+	}
+	if *once {
+		return syncOnce(ctx, s, modfile, stateFile, *force)
 	}
 
-	allObjs, err := objects.ParseAllObjectStates(path.Join(p, objectsSubdir), lua)
+	log.Printf("watching %s", modfile)
+	synced, _ := os.Stat(modfile)
+	var pending os.FileInfo
+	// blocked is set while the config directory differs from the last sync.
+	blocked := false
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(*interval):
+		}
+		if blocked {
+			if changes, err := s.Changes(); err != nil || len(changes) > 0 {
+				continue
+			}
+			log.Printf("%s matches the last sync again", cPath)
+			// sync the save as it is now, even if it was tried before.
+			blocked, synced = false, nil
+		}
+		fi, err := os.Stat(modfile)
+		if err != nil || sameFile(fi, synced) {
+			pending = nil
+			continue
+		}
+		// TTS writes saves in several steps, so wait until the file has
+		// stayed the same for a whole interval.
+		if !sameFile(fi, pending) {
+			pending = fi
+			continue
+		}
+		err = syncOnce(ctx, s, modfile, stateFile, *force)
+		*force = false
+		if err != nil {
+			log.Printf("sync : %v", err)
+			var conflict *modcreator.SyncConflictError
+			if errors.As(err, &conflict) {
+				log.Printf("the save is synced once those files are as the last sync left them; to overwrite them instead, stop and sync with --force")
+				blocked = true
+			}
+		}
+		synced, pending = fi, nil
+	}
+}
+
+// writeSyncState records the state of the last sync in stateFile.
+func writeSyncState(stateFile string, state modcreator.SyncState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
-		return nil, fmt.Errorf("objects.ParseAllObjectStates(%s) : %v", path.Join(p, objectsSubdir), err)
+		return fmt.Errorf("json.MarshalIndent(<sync state>) : %v", err)
 	}
-	m.Data[expectedObjStates] = allObjs
-	return &m, nil
+	return saves.WriteFile(stateFile, b)
 }
 
-func tryPut(d *Obj, from, to string, fun func(string) (interface{}, error)) {
-	if d == nil {
-		log.Println("Nil objects")
-		return
+// sameFile reports whether a and b look like the same version of a file.
+func sameFile(a, b os.FileInfo) bool {
+	return a != nil && b != nil && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// syncOnce reverses the save file modfile with s, printing what changed and
+// recording it in stateFile.
+func syncOnce(ctx context.Context, s *modcreator.Syncer, modfile, stateFile string, force bool) error {
+	m, err := modcreator.ReadMod(modfile)
+	if err != nil {
+		return err
 	}
+	checkScripts(m.Data, *clean)
+	synced, err := s.Sync(ctx, m, force)
+	if err != nil {
+		return err
+	}
+	if err := writeSyncState(stateFile, s.State()); err != nil {
+		return err
+	}
+	for _, c := range synced.Conflicts {
+		fmt.Printf("conflict: %v\n", c)
+	}
+	if len(synced.Objects) == 0 && len(synced.Files) == 0 {
+		fmt.Printf("%s synced, nothing changed\n", modfile)
+		return nil
+	}
+	fmt.Printf("%s synced, %v objects changed\n", modfile, len(synced.Objects))
+	for _, c := range synced.Objects {
+		fmt.Printf("  %v\n", c)
+	}
+	for _, c := range synced.Files {
+		fmt.Printf("  %v\n", c)
+	}
+	return nil
+}
 
-	var o interface{}
-	fromFile, ok := (*d)[from]
-	if !ok {
-		fromFile = ""
-		if _, ok := (*d)[to]; ok {
-			// if there is not special key, but there is existant key, don't replace anything.
-			return
+// runRegui changes object GUIDs given as old=new pairs.
+func runRegui(cPath string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected at least one <old>=<new> argument")
+	}
+	changes := []regui.Change{}
+	for _, a := range args {
+		c, err := regui.ParseChange(a)
+		if err != nil {
+			return err
 		}
+		changes = append(changes, c)
 	}
-	filename, ok := fromFile.(string)
+	fsys, ok := options(cPath).FS.(file.WriteFS)
 	if !ok {
-		log.Printf("non string filename found: %s", fromFile)
-		filename = ""
+		return file.ErrReadOnly
 	}
-
-	o, _ = fun(filename)
-	// ignore error for now
-
-	(*d)[to] = o
-	delete((*d), from)
+	return regui.Apply(fsys, textSubdir, objectsSubdir, changes)
 }
 
-func printMod(p string, m *Mod) error {
-	b, err := json.MarshalIndent(m.Data, "", "  ")
+// runLocate prints the source file and line of a line in a built script.
+// args are either a GUID (or Global) and a line, or a TTS error message.
+func runLocate(cPath string, args []string) error {
+	owner, line, err := sourcemap.ParseLocation(args)
 	if err != nil {
-		return fmt.Errorf("json.MarshalIndent(<mod>) : %v", err)
+		return err
 	}
-
-	return ioutil.WriteFile(path.Join(p, "output.json"), b, 0644)
+	sm, err := sourcemap.Read(path.Join(cPath, sourceMapFile))
+	if err != nil {
+		return fmt.Errorf("sourcemap.Read(%s) : %v", path.Join(cPath, sourceMapFile), err)
+	}
+	found, err := sm.Locate(owner, line)
+	if err != nil {
+		return err
+	}
+	for _, l := range found {
+		fmt.Printf("%s:%v\n", l.File, l.Line)
+	}
+	return nil
 }
 
-// prepForReverse creates the expected subdirectories in config path
-func prepForReverse(cPath, modfile string) (Obj, error) {
-	subDirs := []string{textSubdir, jsonSubdir, objectsSubdir}
+// runTests builds the mod, then runs lua test files against a mock TTS seeded
+// with its objects. With no files given, every test under src is run.
+func runTests(ctx context.Context, cPath string, files []string) error {
+	opts := options(cPath)
+	opts.Annotate = false
+	m, err := modcreator.Build(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("modcreator.Build(%s) : %v", cPath, err)
+	}
+	if len(files) == 0 {
+		src, err := file.SubFS(opts.FS, textSubdir)
+		if err != nil {
+			return err
+		}
+		files, err = luatest.FindTests(src)
+		if err != nil {
+			return fmt.Errorf("luatest.FindTests(%s) : %v", path.Join(cPath, textSubdir), err)
+		}
+	}
 
-	for _, s := range subDirs {
-		p := path.Join(cPath, s)
-		if _, err := os.Stat(p); err == nil {
-			// directory already exists
-		} else if os.IsNotExist(err) {
-			err = os.Mkdir(p, 0777)
-			if err != nil {
-				return nil, err
+	objs, _ := m.Data.Get("ObjectStates")
+	r := &luatest.Runner{Lua: m.Lua, Objects: objs}
+	failed := 0
+	for _, f := range files {
+		results, err := r.Run(f)
+		if err != nil {
+			fmt.Printf("FAIL %s : %v\n", f, err)
+			failed++
+			continue
+		}
+		for _, res := range results {
+			fmt.Println(res)
+			if res.Err != nil {
+				failed++
 			}
-		} else {
-			return nil, fmt.Errorf("Undefined error checking for subdirectory %s : %v", s, err)
 		}
 	}
+	if failed > 0 {
+		return fmt.Errorf("%v tests failed", failed)
+	}
+	return nil
+}
+
+// runFmt rewrites the config directory into its canonical layout. With
+// --check, nothing is written and unformatted files are an error.
+func runFmt(cPath string, args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "Only list files which aren't formatted, and fail if there are any.")
+	flags.Parse(args)
 
-	mFile, err := os.Open(modfile)
+	changed, err := format.Tree(options(cPath).FS, textSubdir, jsonSubdir, objectsSubdir, *check)
+	for _, f := range changed {
+		fmt.Println(f)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("os.Open(%s) : %v", modfile, err)
+		return err
+	}
+	if *check && len(changed) > 0 {
+		return fmt.Errorf("%v files are not formatted", len(changed))
 	}
+	return nil
+}
 
-	defer mFile.Close()
+// runScan looks for malicious scripts in a mod file, and removes them from
+// the file if asked to.
+func runScan(modfile string, clean bool) error {
+	m, err := modcreator.ReadMod(modfile)
+	if err != nil {
+		return err
+	}
+	raw := m.Data
+	malicious := checkScripts(raw, clean)
+	if !clean {
+		if malicious > 0 {
+			return fmt.Errorf("found %v malicious script lines, rerun with --clean to remove them", malicious)
+		}
+		return nil
+	}
+	b, err := ttsjson.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("ttsjson.Marshal(<mod>) : %v", err)
+	}
+	return ioutil.WriteFile(modfile, b, 0644)
+}
 
-	b, err := ioutil.ReadAll(mFile)
+// checkScripts logs anything malicious or suspicious in the mod's scripts,
+// cleaning them if asked to. It returns the number of malicious lines found.
+func checkScripts(raw *ttsjson.Object, clean bool) int {
+	malicious := 0
+	for _, f := range scan.Mod(raw) {
+		if f.Rule.Malicious {
+			malicious++
+		}
+		log.Println(f)
+	}
+	if clean {
+		for _, r := range scan.Clean(raw) {
+			log.Println(r)
+		}
+	} else if malicious > 0 {
+		log.Printf("found %v malicious script lines; use --clean to remove them", malicious)
+	}
+	return malicious
+}
+
+// runDeps prints the graph of lua modules required by Global and each
+// object's script, as graphviz DOT or, with --json, as json.
+func runDeps(ctx context.Context, cPath string, args []string) error {
+	flags := flag.NewFlagSet("deps", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the graph as json instead of DOT.")
+	sharedBy := flags.Int("shared", 3, "Flag modules included by at least this many scripts.")
+	flags.Parse(args)
+
+	opts := options(cPath)
+	opts.Annotate = false
+	lua, err := modcreator.Scripts(ctx, opts)
+	if err != nil {
+		return err
+	}
+	g, err := deps.Build(deps.Tree{
+		FS:            opts.FS,
+		TextSubdir:    textSubdir,
+		ObjectsSubdir: objectsSubdir,
+		Modules:       []string{guids.ModuleName, buildinfo.ModuleName},
+	}, lua, *sharedBy)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if !*asJSON {
+		fmt.Print(g.DOT())
+		return nil
 	}
-	var o Obj
-	err = json.Unmarshal(b, &o)
+	b, err := json.MarshalIndent(g, "", "  ")
 	if err != nil {
-		return nil, err
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+// runLint prints every structural problem in the config directory cPath, as
+// text or as a json array with --json, and fails if there are any.
+func runLint(cPath string, args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the findings as a json array.")
+	flags.Parse(args)
+
+	found, err := lint.Run(lint.Tree{
+		FS:            options(cPath).FS,
+		TextSubdir:    textSubdir,
+		JSONSubdir:    jsonSubdir,
+		ObjectsSubdir: objectsSubdir,
+		TextKeys:      modcreator.DefaultStringKeys,
+		Modules:       []string{guids.ModuleName, buildinfo.ModuleName},
+	})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		b, err := json.MarshalIndent(found, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	} else {
+		for _, f := range found {
+			fmt.Println(f)
+		}
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("%v problems found", len(found))
 	}
+	return nil
+}
 
-	return o, nil
+// printMod writes the mod built from the config directory p to out: a file,
+// - for stdout, or a TTS Saves directory, where it gets a save's date and
+// thumbnail. An empty out is output.json in p.
+func printMod(p, out string, m *modcreator.Mod) error {
+	if out == "" {
+		out = path.Join(p, "output.json")
+	}
+	if fi, err := os.Stat(out); err == nil && fi.IsDir() {
+		f, err := saves.Write(out, *saveName, m.Data, m.Info.Time, imagePath(p, m.Data))
+		if err != nil {
+			return err
+		}
+		log.Printf("saved %s", f)
+		return nil
+	}
+	b, err := ttsjson.Marshal(m.Data)
+	if err != nil {
+		return fmt.Errorf("ttsjson.Marshal(<mod>) : %v", err)
+	}
+	if out == "-" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return saves.WriteFile(out, b)
 }
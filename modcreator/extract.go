@@ -0,0 +1,157 @@
+package modcreator
+
+import (
+	"ModCreator/guids"
+	"ModCreator/objects"
+	"ModCreator/selector"
+	"ModCreator/ttsjson"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// StubScript is what Extract replaces Global's script with, when asked to.
+const StubScript = "-- Global script left out by extract\n"
+
+// like getObjectFromGUID("abc123"), getObjectFromGUID('abc123') or
+// getObjectFromGUID(GUIDS.MainBoard)
+var objectFromGUID = regexp.MustCompile(`getObjectFromGUID\(\s*(?:["']([0-9a-fA-F]{6})["']|` + guids.TableName + `\.([A-Za-z_][A-Za-z0-9_]*))\s*\)`)
+
+// ExtractOptions say what Extract keeps besides the selected objects.
+type ExtractOptions struct {
+	// StubGlobal replaces Global's script with StubScript, and empties its
+	// LuaScriptState and XmlUI, which would refer to objects left out.
+	StubGlobal bool
+	// Referenced also keeps the objects the scripts of kept objects get by
+	// getObjectFromGUID, and those their scripts get, and so on. GUIDs may be
+	// given as they are, or by their name in the generated GUID module.
+	Referenced bool
+}
+
+// Extract builds a mod holding only the objects sel selects, and those they
+// contain, along with all of the mod's own settings like its table, sky and
+// lighting. It is meant for testing a few components without loading the
+// whole mod.
+func Extract(ctx context.Context, opts Options, sel selector.Selector, x ExtractOptions) (*Mod, error) {
+	opts = opts.withDefaults()
+	m, err := Build(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	all, _ := m.Data.Array(objectStates)
+	picked := sel.Pick(all)
+	kept := guids.Collect(toInterfaces(picked))
+	for _, p := range sel.Paths {
+		f, err := FindObject(opts, p)
+		if err != nil {
+			return nil, err
+		}
+		objFS, err := opts.sub(opts.ObjectsSubdir)
+		if err != nil {
+			return nil, err
+		}
+		o, err := objects.ParseObject(objFS, m.Lua, f, m.Origins)
+		if err != nil {
+			return nil, &FileError{File: opts.name(path.Join(opts.ObjectsSubdir, f)), Err: err}
+		}
+		if g, _ := o.String("GUID"); kept[g] {
+			continue
+		}
+		guids.StripScriptNames([]interface{}{o})
+		picked = append(picked, o)
+		for g := range guids.Collect([]interface{}{o}) {
+			kept[g] = true
+		}
+	}
+	if len(picked) == 0 {
+		return nil, fmt.Errorf("nothing in the mod matches : %w", ErrNoObject)
+	}
+
+	if x.Referenced {
+		names, err := guidNames(opts)
+		if err != nil {
+			return nil, err
+		}
+		// only loose objects can be found by getObjectFromGUID.
+		loose := map[string]*ttsjson.Object{}
+		for _, raw := range all {
+			if o, ok := raw.(*ttsjson.Object); ok {
+				if g, _ := o.String("GUID"); loose[strings.ToLower(g)] == nil {
+					loose[strings.ToLower(g)] = o
+				}
+			}
+		}
+		for i := 0; i < len(picked); i++ {
+			for _, g := range referenced(picked[i], names) {
+				o, ok := loose[strings.ToLower(g)]
+				if !ok {
+					continue
+				}
+				if g, _ := o.String("GUID"); kept[g] {
+					continue
+				}
+				picked = append(picked, o)
+				for g := range guids.Collect([]interface{}{o}) {
+					kept[g] = true
+				}
+			}
+		}
+	}
+
+	m.Data.Set(objectStates, toInterfaces(picked))
+	if x.StubGlobal {
+		m.Data.Set("LuaScript", StubScript)
+		for _, k := range []string{"LuaScriptState", "XmlUI"} {
+			if _, ok := m.Data.Get(k); ok {
+				m.Data.Set(k, "")
+			}
+		}
+	}
+	return m, nil
+}
+
+// referenced lists the GUIDs the scripts of o, and the objects it contains,
+// get by getObjectFromGUID. names maps the keys of the generated GUID module
+// to their GUIDs.
+func referenced(o *ttsjson.Object, names map[string]string) []string {
+	found := []string{}
+	objects.Walk([]interface{}{o}, func(o *ttsjson.Object) {
+		script, _ := o.String("LuaScript")
+		for _, m := range objectFromGUID.FindAllStringSubmatch(script, -1) {
+			if m[1] != "" {
+				found = append(found, m[1])
+			} else if g, ok := names[m[2]]; ok {
+				found = append(found, g)
+			}
+		}
+	})
+	return found
+}
+
+// guidNames maps the keys of the GUID module building opts generates to
+// their GUIDs.
+func guidNames(opts Options) (map[string]string, error) {
+	objFS, err := opts.sub(opts.ObjectsSubdir)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := objects.ReadObjectStates(objFS)
+	if err != nil {
+		return nil, &FileError{File: opts.name(opts.ObjectsSubdir), Err: err}
+	}
+	names := map[string]string{}
+	for _, e := range guids.Entries(objs) {
+		names[e.Key] = e.GUID
+	}
+	return names, nil
+}
+
+func toInterfaces(objs []*ttsjson.Object) []interface{} {
+	arr := []interface{}{}
+	for _, o := range objs {
+		arr = append(arr, o)
+	}
+	return arr
+}
@@ -0,0 +1,436 @@
+// Package modcreator builds a TTS mod from a config directory, and reverses a
+// mod into one. It is what the command line tool runs, for tools which want to
+// do the same without it.
+package modcreator
+
+import (
+	"ModCreator/buildinfo"
+	"ModCreator/file"
+	"ModCreator/guids"
+	"ModCreator/objects"
+	"ModCreator/policy"
+	"ModCreator/ttsjson"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// TextSubdir, JSONSubdir and ObjectsSubdir are the default folders of a
+	// config directory.
+	TextSubdir    = "src"
+	JSONSubdir    = "json"
+	ObjectsSubdir = "objects"
+
+	// ConfigFile is the file of a config directory the mod is built around.
+	ConfigFile = "config.json"
+	// PolicyFile is the policy file Reverse looks for in the config
+	// directory.
+	PolicyFile = "extract.json"
+
+	// definesKey lists preprocessor symbols in config.json. It is not part of
+	// the built mod.
+	definesKey   = "Defines"
+	objectStates = "ObjectStates"
+	pathExt      = "_path"
+)
+
+var (
+	// DefaultStringKeys, DefaultObjectKeys and DefaultArrayKeys are the save
+	// keys expected to hold text, json objects and arrays of json objects.
+	DefaultStringKeys = []string{"SaveName", "Date", "VersionNumber", "GameMode", "GameType", "GameComplexity", "Table", "Sky", "Note", "LuaScript", "LuaScriptState", "XmlUI"}
+	DefaultObjectKeys = []string{"TabStates", "MusicPlayer", "Grid", "Lighting", "Hands", "ComponentTags", "Turns"}
+	DefaultArrayKeys  = []string{"CameraStates", "DecalPallet", "CustomUIAssets", "SnapPoints"}
+
+	// ErrNoConfig is wrapped by the error of building a directory without a
+	// config.json.
+	ErrNoConfig = errors.New("no " + ConfigFile)
+)
+
+// FileError is a file of the config directory, or a mod file, which couldn't
+// be read or written.
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s : %v", e.File, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Options says where a config directory is and how it is laid out. Only Dir
+// or FS is required; everything else has a default.
+type Options struct {
+	// Dir is the config directory, holding config.json.
+	Dir string
+	// FS is the config directory instead of Dir, to build from memory, a zip
+	// or an embedded tree. Reverse, and Annotate, need it to be a
+	// file.WriteFS. Build info is still read from the git repository
+	// containing Dir, if Dir is given too.
+	FS fs.FS
+	// TextSubdir, JSONSubdir and ObjectsSubdir are the folders of Dir
+	// holding scripts and text, json values and objects.
+	TextSubdir    string
+	JSONSubdir    string
+	ObjectsSubdir string
+	// StringKeys, ObjectKeys and ArrayKeys are the save keys expected to hold
+	// text, json objects and arrays of json objects.
+	StringKeys []string
+	ObjectKeys []string
+	ArrayKeys  []string
+
+	// Defines are preprocessor symbols, added to those config.json lists.
+	Defines []string
+	// BuildTime pins the build time: RFC3339, seconds since the epoch or
+	// buildinfo.PinCommit. Empty means $SOURCE_DATE_EPOCH, then now.
+	BuildTime string
+	// Annotate also writes the generated GUID module, with EmmyLua
+	// annotations, into the text folder for editors.
+	Annotate bool
+
+	// Policy decides which values Reverse writes to files of their own. When
+	// nil, PolicyFile is read if given, then extract.json in Dir if there is
+	// one, ahead of the defaults.
+	Policy     *policy.Policy
+	PolicyFile string
+	// Naming is what Reverse names new object files after.
+	Naming objects.Naming
+}
+
+func (o Options) withDefaults() Options {
+	if o.FS == nil {
+		if o.Dir == "" {
+			o.Dir = "."
+		}
+		o.FS = file.DirFS(o.Dir)
+	}
+	if o.TextSubdir == "" {
+		o.TextSubdir = TextSubdir
+	}
+	if o.JSONSubdir == "" {
+		o.JSONSubdir = JSONSubdir
+	}
+	if o.ObjectsSubdir == "" {
+		o.ObjectsSubdir = ObjectsSubdir
+	}
+	if o.StringKeys == nil {
+		o.StringKeys = DefaultStringKeys
+	}
+	if o.ObjectKeys == nil {
+		o.ObjectKeys = DefaultObjectKeys
+	}
+	if o.ArrayKeys == nil {
+		o.ArrayKeys = DefaultArrayKeys
+	}
+	if o.Naming == nil {
+		o.Naming = objects.DefaultNaming
+	}
+	return o
+}
+
+// name is the name of the file rel of the config directory, for errors.
+func (o Options) name(rel string) string {
+	return filepath.Join(o.Dir, filepath.FromSlash(rel))
+}
+
+// sub is the folder dir of the config directory.
+func (o Options) sub(dir string) (fs.FS, error) {
+	fsys, err := file.SubFS(o.FS, dir)
+	if err != nil {
+		return nil, &FileError{File: o.name(dir), Err: err}
+	}
+	return fsys, nil
+}
+
+// writable is the config directory, which is about to be written to.
+func (o Options) writable() (file.WriteFS, error) {
+	w, ok := o.FS.(file.WriteFS)
+	if !ok {
+		return nil, &FileError{File: o.name("."), Err: file.ErrReadOnly}
+	}
+	return w, nil
+}
+
+// Mod is a TTS save, as it is written to a mod file.
+type Mod struct {
+	Data *ttsjson.Object
+	// Lua resolves requires the way building the mod did, or is nil for a
+	// mod which wasn't built.
+	Lua *file.LuaOps
+	// Origins says where the lines of each script came from, for a built mod.
+	Origins file.ScriptOrigins
+	// Info is the build information the mod was built with.
+	Info buildinfo.Info
+}
+
+// Build reads the config directory and assembles the mod from it.
+func Build(ctx context.Context, opts Options) (*Mod, error) {
+	opts = opts.withDefaults()
+	lua, c, info, err := prepare(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := generate(ctx, opts, lua, c)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range m.Data.Keys() {
+		if s, ok := m.Data.String(k); ok && k != "LuaScript" && k != "LuaScriptState" {
+			// scripts get build info from the generated module instead.
+			m.Data.Set(k, info.Substitute(s))
+		}
+	}
+	m.Lua = lua
+	m.Info = info
+	return m, nil
+}
+
+// Scripts returns a LuaOps for the text folder which resolves requires as
+// Build does: with the preprocessor symbols defined and the generated modules
+// added.
+func Scripts(ctx context.Context, opts Options) (*file.LuaOps, error) {
+	lua, _, _, err := prepare(ctx, opts.withDefaults())
+	return lua, err
+}
+
+func prepare(ctx context.Context, opts Options) (*file.LuaOps, *ttsjson.Object, buildinfo.Info, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, buildinfo.Info{}, err
+	}
+	text, err := opts.sub(opts.TextSubdir)
+	if err != nil {
+		return nil, nil, buildinfo.Info{}, err
+	}
+	lua := file.NewLuaOpsFS(text)
+	c, err := readConfig(opts)
+	if err != nil {
+		return nil, nil, buildinfo.Info{}, err
+	}
+	if err := defineSymbols(c, lua, opts.Defines); err != nil {
+		return nil, nil, buildinfo.Info{}, &FileError{File: opts.name(ConfigFile), Err: err}
+	}
+	if err := addGUIDModule(opts, lua); err != nil {
+		return nil, nil, buildinfo.Info{}, err
+	}
+	var info buildinfo.Info
+	if opts.Dir == "" {
+		info, err = buildinfo.Now(opts.BuildTime)
+	} else {
+		info, err = buildinfo.Read(opts.Dir, opts.BuildTime)
+	}
+	if errors.Is(err, buildinfo.ErrNoRepository) {
+		log.Printf("%s is not in a git repository, build info will be empty", opts.Dir)
+	} else if errors.Is(err, buildinfo.ErrNoGit) {
+		log.Printf("git is not installed, build info will be empty")
+	} else if err != nil {
+		return nil, nil, buildinfo.Info{}, fmt.Errorf("buildinfo.Read(%s) : %w", opts.Dir, err)
+	}
+	lua.AddModule(buildinfo.ModuleName, info.Module())
+	return lua, c, info, nil
+}
+
+// defineSymbols gives the lua preprocessor the symbols listed in config.json
+// and those given.
+func defineSymbols(c *ttsjson.Object, lua *file.LuaOps, syms []string) error {
+	if raw, ok := c.Get(definesKey); ok {
+		arr, ok := raw.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected an array of strings in %s, got %v", definesKey, raw)
+		}
+		for _, rawSym := range arr {
+			sym, ok := rawSym.(string)
+			if !ok {
+				return fmt.Errorf("expected an array of strings in %s, got %v", definesKey, raw)
+			}
+			lua.Define(sym)
+		}
+		c.Delete(definesKey)
+	}
+	for _, sym := range syms {
+		if sym = strings.TrimSpace(sym); sym != "" {
+			lua.Define(sym)
+		}
+	}
+	return nil
+}
+
+func readConfig(opts Options) (*ttsjson.Object, error) {
+	p := opts.name(ConfigFile)
+	b, err := fs.ReadFile(opts.FS, ConfigFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &FileError{File: p, Err: ErrNoConfig}
+	}
+	if err != nil {
+		return nil, &FileError{File: p, Err: err}
+	}
+	c, err := ttsjson.UnmarshalObject(b)
+	if err != nil {
+		return nil, &FileError{File: p, Err: err}
+	}
+	return c, nil
+}
+
+func generate(ctx context.Context, opts Options, lua file.LuaReader, c *ttsjson.Object) (*Mod, error) {
+	jsonFS, err := opts.sub(opts.JSONSubdir)
+	if err != nil {
+		return nil, err
+	}
+	j := file.NewJSONOpsFS(jsonFS)
+	m := &Mod{Data: c, Origins: file.ScriptOrigins{}}
+
+	plainObj := func(s string) (interface{}, error) {
+		return j.ReadObj(s)
+	}
+	objArray := func(s string) (interface{}, error) {
+		return j.ReadObjArray(s)
+	}
+	textGet := func(s string) (interface{}, error) {
+		return lua.ReadText(s)
+	}
+	scriptGet := func(s string) (interface{}, error) {
+		script, origins, err := lua.ExpandFile(s)
+		m.Origins[m.Data] = origins
+		return script, err
+	}
+
+	stateGet := func(s string) (interface{}, error) {
+		return lua.ReadState(s)
+	}
+
+	for _, stringbased := range opts.StringKeys {
+		get := textGet
+		switch stringbased {
+		case "LuaScript":
+			get = scriptGet
+		case "LuaScriptState":
+			get = stateGet
+		}
+		tryPut(m.Data, stringbased+pathExt, stringbased, get)
+	}
+
+	for _, objbased := range opts.ObjectKeys {
+		tryPut(m.Data, objbased+pathExt, objbased, plainObj)
+	}
+
+	for _, objarraybased := range opts.ArrayKeys {
+		tryPut(m.Data, objarraybased+pathExt, objarraybased, objArray)
+	}
+
+	// any other key a policy file had written out: objects and arrays went
+	// under json, and text under src.
+	anyJSON := func(s string) (interface{}, error) {
+		if o, err := j.ReadObj(s); err == nil {
+			return o, nil
+		}
+		return j.ReadObjArray(s)
+	}
+	for _, k := range m.Data.Keys() {
+		key := strings.TrimSuffix(k, pathExt)
+		if key == k || key == objectStates {
+			continue
+		}
+		get := textGet
+		if fname, _ := m.Data.String(k); strings.HasSuffix(fname, ".json") {
+			get = anyJSON
+		}
+		tryPut(m.Data, k, key, get)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	order := []string{}
+	if rawOrder, ok := m.Data.Get(objectStates + objects.OrderKey); ok {
+		arr, _ := rawOrder.([]interface{})
+		for _, name := range arr {
+			if s, ok := name.(string); ok {
+				order = append(order, s)
+			}
+		}
+		m.Data.Delete(objectStates + objects.OrderKey)
+	}
+	objFS, err := opts.sub(opts.ObjectsSubdir)
+	if err != nil {
+		return nil, err
+	}
+	allObjs, err := objects.ParseAllObjectStates(objFS, lua, order, m.Origins)
+	if err != nil {
+		return nil, &FileError{File: opts.name(opts.ObjectsSubdir), Err: err}
+	}
+	guids.StripScriptNames(allObjs)
+	// ObjectStates_path only marks where the objects go.
+	m.Data.Rename(objectStates+pathExt, objectStates)
+	m.Data.Set(objectStates, allObjs)
+	return m, nil
+}
+
+// addGUIDModule lets scripts require a table of every object's GUID keyed by
+// its name.
+func addGUIDModule(opts Options, lua *file.LuaOps) error {
+	objFS, err := opts.sub(opts.ObjectsSubdir)
+	if err != nil {
+		return err
+	}
+	objs, err := objects.ReadObjectStates(objFS)
+	if err != nil {
+		return &FileError{File: opts.name(opts.ObjectsSubdir), Err: err}
+	}
+	module := guids.Module(objs, opts.Annotate)
+	lua.AddModule(guids.ModuleName, module)
+	if !opts.Annotate {
+		return nil
+	}
+	w, err := opts.writable()
+	if err != nil {
+		return err
+	}
+	p := path.Join(opts.TextSubdir, guids.ModuleName+".ttslua")
+	if err := w.MkdirAll(path.Dir(p), 0755); err != nil {
+		return &FileError{File: opts.name(path.Dir(p)), Err: err}
+	}
+	if err := w.WriteFile(p, []byte(module), 0644); err != nil {
+		return &FileError{File: opts.name(p), Err: err}
+	}
+	return nil
+}
+
+func tryPut(d *ttsjson.Object, from, to string, fun func(string) (interface{}, error)) {
+	if d == nil {
+		log.Println("Nil objects")
+		return
+	}
+
+	var o interface{}
+	fromFile, ok := d.Get(from)
+	if !ok {
+		fromFile = ""
+		if _, ok := d.Get(to); ok {
+			// if there is not special key, but there is existant key, don't replace anything.
+			return
+		}
+	}
+	filename, ok := fromFile.(string)
+	if !ok {
+		log.Printf("non string filename found: %s", fromFile)
+		filename = ""
+	}
+
+	o, err := fun(filename)
+	if err != nil && filename != "" {
+		log.Printf("reading %s for %s : %v", filename, to, err)
+	}
+
+	// the value goes back where its _path key was.
+	d.Rename(from, to)
+	d.Set(to, o)
+}
@@ -0,0 +1,528 @@
+package modcreator
+
+import (
+	"ModCreator/file"
+	"ModCreator/regui"
+	"ModCreator/saves"
+	"ModCreator/selector"
+	"ModCreator/ttsjson"
+	"context"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const save = `{
+  "SaveName": "Test",
+  "LuaScript": "function onLoad() print('a global script long enough to get a file of its own') end",
+  "ObjectStates": [
+    {
+      "GUID": "abc123",
+      "Name": "Card",
+      "LuaScript": "function onLoad() print('a card script long enough to be written to a file too') end"
+    }
+  ]
+}
+`
+
+func TestReverseBuild(t *testing.T) {
+	mf := filepath.Join(t.TempDir(), "mod.json")
+	if err := ioutil.WriteFile(mf, []byte(save), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ReadMod(mf)
+	if err != nil {
+		t.Fatalf("ReadMod() : %v", err)
+	}
+	opts := Options{Dir: t.TempDir(), TextSubdir: "lua", ObjectsSubdir: "things", BuildTime: "0"}
+	if err := Reverse(context.Background(), m, opts); err != nil {
+		t.Fatalf("Reverse() : %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(opts.Dir, "lua", "Card.abc123.ttslua")); err != nil {
+		t.Errorf("want the card script under lua : %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(opts.Dir, "things", "Card.abc123.json")); err != nil {
+		t.Errorf("want the card under things : %v", err)
+	}
+	if _, ok := m.Data.Get("LuaScript"); !ok {
+		t.Errorf("want the mod left unchanged")
+	}
+
+	built, err := Build(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Build() : %v", err)
+	}
+	want, err := ttsjson.UnmarshalObject([]byte(save))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"SaveName", "LuaScript", "ObjectStates"} {
+		w, _ := want.Get(k)
+		g, _ := built.Data.Get(k)
+		wb, _ := ttsjson.Marshal(w)
+		gb, _ := ttsjson.Marshal(g)
+		if string(wb) != string(gb) {
+			t.Errorf("%s : want %s got %s", k, wb, gb)
+		}
+	}
+}
+
+func TestGlobalState(t *testing.T) {
+	state := `{"round":3,"players":["Red","Blue","Green","Yellow"],"scores":{"Red":10,"Blue":7}}`
+	m, err := ttsjson.UnmarshalObject([]byte(strings.Replace(save, `"SaveName": "Test",`, `"SaveName": "Test", "LuaScriptState": `+strconv.Quote(state)+`,`, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := file.NewMemFS()
+	opts := Options{FS: mem, BuildTime: "0"}
+	if err := Reverse(context.Background(), &Mod{Data: m}, opts); err != nil {
+		t.Fatalf("Reverse() : %v", err)
+	}
+	if _, err := fs.Stat(mem, "src/LuaScriptState"+file.StateExt); err != nil {
+		t.Errorf("want Global's state in a %s file : %v", file.StateExt, err)
+	}
+	built, err := Build(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Build() : %v", err)
+	}
+	if got, _ := built.Data.String("LuaScriptState"); got != state {
+		t.Errorf("want state %s got %s", state, got)
+	}
+}
+
+func TestTextFields(t *testing.T) {
+	notes := "--#if DEBUG\nrequire(\"lib/util\")\n--#endif"
+	ui := `<Text>require("lib/util")</Text>`
+	mem := file.NewMemFS()
+	for name, content := range map[string]string{
+		"config.json":         `{"SaveName": "Test", "XmlUI_path": "ui.xml", "ObjectStates_path": "objects"}`,
+		"objects/Card.json":   `{"GUID": "abc123", "Name": "Card", "GMNotes_path": "notes.txt", "LuaScript_path": "card.ttslua"}`,
+		"src/ui.xml":          ui,
+		"src/notes.txt":       notes,
+		"src/card.ttslua":     `require("lib/util")`,
+		"src/lib/util.ttslua": "x = 1",
+	} {
+		if err := mem.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := mem.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	built, err := Build(context.Background(), Options{FS: mem, BuildTime: "0"})
+	if err != nil {
+		t.Fatalf("Build() : %v", err)
+	}
+	if got, _ := built.Data.String("XmlUI"); got != ui {
+		t.Errorf("want XmlUI %s got %s", ui, got)
+	}
+	objs, _ := built.Data.Array(objectStates)
+	card := objs[0].(*ttsjson.Object)
+	if got, _ := card.String("GMNotes"); got != notes {
+		t.Errorf("want GMNotes %s got %s", notes, got)
+	}
+	if got, _ := card.String("LuaScript"); !strings.Contains(got, "x = 1") {
+		t.Errorf("want the script's require expanded, got %s", got)
+	}
+}
+
+func TestReverseKeepsRequires(t *testing.T) {
+	mem := file.NewMemFS()
+	for name, content := range map[string]string{
+		"config.json":         `{"SaveName": "Test", "LuaScript_path": "Global.ttslua", "ObjectStates_path": "objects"}`,
+		"objects/Card.json":   `{"GUID": "abc123", "Name": "Card", "LuaScript_path": "card.ttslua"}`,
+		"src/Global.ttslua":   "require(\"lib/util\")\nglobal = true",
+		"src/card.ttslua":     "require(\"lib/util\")\ncard = true",
+		"src/lib/util.ttslua": "x = 1",
+	} {
+		if err := mem.MkdirAll(path.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := mem.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := Options{FS: mem, BuildTime: "0"}
+	built, err := Build(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Build() : %v", err)
+	}
+	if err := Reverse(context.Background(), built, opts); err != nil {
+		t.Fatalf("Reverse() : %v", err)
+	}
+	for _, f := range []string{"src/Global.ttslua", "src/card.ttslua"} {
+		if b, _ := fs.ReadFile(mem, f); !strings.HasPrefix(string(b), `require("lib/util")`) {
+			t.Errorf("want %s to keep its require, got %s", f, b)
+		}
+	}
+
+	// a script changed in game can't be written without inlining the require.
+	built, err = Build(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Build() : %v", err)
+	}
+	objs, _ := built.Data.Array(objectStates)
+	card := objs[0].(*ttsjson.Object)
+	script, _ := card.String("LuaScript")
+	card.Set("LuaScript", script+"\nchanged = true")
+	err = Reverse(context.Background(), built, opts)
+	var ce *ConflictError
+	if !errors.As(err, &ce) || len(ce.Conflicts) != 1 || ce.Conflicts[0].File != "card.ttslua" {
+		t.Errorf("want a conflict for card.ttslua, got %v", err)
+	}
+	if b, _ := fs.ReadFile(mem, "src/card.ttslua"); string(b) != "require(\"lib/util\")\ncard = true" {
+		t.Errorf("want card.ttslua unchanged, got %s", b)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Build(context.Background(), Options{Dir: dir})
+	var fe *FileError
+	if !errors.Is(err, ErrNoConfig) || !errors.As(err, &fe) || fe.File != filepath.Join(dir, ConfigFile) {
+		t.Errorf("want ErrNoConfig for %s, got %v", filepath.Join(dir, ConfigFile), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Build(ctx, Options{Dir: dir}); !errors.Is(err, context.Canceled) {
+		t.Errorf("want context.Canceled, got %v", err)
+	}
+
+	// two files of one folder claiming the same object.
+	objs := filepath.Join(dir, ObjectsSubdir)
+	if err := os.MkdirAll(objs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"A.json", "B.json"} {
+		if err := ioutil.WriteFile(filepath.Join(objs, f), []byte(`{"GUID": "abc123", "Name": "Card"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := ttsjson.UnmarshalObject([]byte(save))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Reverse(context.Background(), &Mod{Data: m}, Options{Dir: dir})
+	var ce *ConflictError
+	if !errors.As(err, &ce) || len(ce.Conflicts) != 1 || !strings.Contains(ce.Conflicts[0].String(), "B.json") {
+		t.Errorf("want a conflict for B.json, got %v", err)
+	}
+}
+
+func TestInMemory(t *testing.T) {
+	m, err := ttsjson.UnmarshalObject([]byte(save))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := file.NewMemFS()
+	opts := Options{FS: mem, BuildTime: "0"}
+	if err := Reverse(context.Background(), &Mod{Data: m}, opts); err != nil {
+		t.Fatalf("Reverse() : %v", err)
+	}
+	want := []string{"config.json", "objects/Card.abc123.json", "src/Card.abc123.ttslua", "src/LuaScript.ttslua"}
+	if got := mem.Files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want files %v got %v", want, got)
+	}
+
+	// a read only copy builds just the same.
+	built, err := Build(context.Background(), Options{FS: mem.MapFS, BuildTime: "0"})
+	if err != nil {
+		t.Fatalf("Build() : %v", err)
+	}
+	if g, _ := built.Data.Get("SaveName"); g != "Test" {
+		t.Errorf("want SaveName Test, got %v", g)
+	}
+	err = Reverse(context.Background(), &Mod{Data: m}, Options{FS: mem.MapFS})
+	if !errors.Is(err, file.ErrReadOnly) {
+		t.Errorf("want ErrReadOnly, got %v", err)
+	}
+}
+
+const bagSave = `{
+  "SaveName": "Test",
+  "ObjectStates": [
+    {
+      "GUID": "ba9001",
+      "Name": "Bag",
+      "LuaScript": "function onLoad() getObjectFromGUID('abc123').highlightOn('Red') end -- long enough for a file",
+      "ContainedObjects": [
+        {"GUID": "abc123", "Name": "Card", "Nickname": "Ace"}
+      ]
+    },
+    {"GUID": "b0c001", "Name": "Box"}
+  ]
+}
+`
+
+func TestExportImportObject(t *testing.T) {
+	m, err := ttsjson.UnmarshalObject([]byte(bagSave))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := file.NewMemFS()
+	opts := Options{FS: mem, BuildTime: "0"}
+	if err := Reverse(context.Background(), &Mod{Data: m}, opts); err != nil {
+		t.Fatalf("Reverse() : %v", err)
+	}
+	if _, err := FindObject(opts, "ffffff"); !errors.Is(err, ErrNoObject) {
+		t.Errorf("want ErrNoObject, got %v", err)
+	}
+	exported, err := ExportObject(context.Background(), opts, "objects/Bag.ba9001")
+	if err != nil {
+		t.Fatalf("ExportObject() : %v", err)
+	}
+	objs, err := saves.Objects(exported.Data)
+	if err != nil || len(objs) != 1 {
+		t.Fatalf("want one object, got %v, %v", len(objs), err)
+	}
+	if s, _ := objs[0].String("LuaScript"); !strings.Contains(s, "abc123") {
+		t.Errorf("want the bag's script expanded, got %s", s)
+	}
+
+	// a copy of the bag, in the box which had nothing in it.
+	imported, err := ImportObject(context.Background(), exported.Data, "b0c001", opts)
+	if err != nil {
+		t.Fatalf("ImportObject() : %v", err)
+	}
+	wantChanges := []regui.Change{{Old: "ba9001", New: "ba9002"}, {Old: "abc123", New: "abc124"}}
+	if !reflect.DeepEqual(imported.Changes, wantChanges) {
+		t.Errorf("want changes %v got %v", wantChanges, imported.Changes)
+	}
+	if want := []string{"b0c001/Bag.ba9002.json"}; !reflect.DeepEqual(imported.Files, want) {
+		t.Errorf("want files %v got %v", want, imported.Files)
+	}
+
+	built, err := Build(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Build() : %v", err)
+	}
+	states, _ := built.Data.Get("ObjectStates")
+	box := states.([]interface{})[1].(*ttsjson.Object)
+	inBox, _ := box.Array("ContainedObjects")
+	if len(inBox) != 1 {
+		t.Fatalf("want the bag in the box, got %v", inBox)
+	}
+	bag := inBox[0].(*ttsjson.Object)
+	if s, _ := bag.String("LuaScript"); !strings.Contains(s, "getObjectFromGUID('abc124')") {
+		t.Errorf("want the script to refer to the new GUID, got %s", s)
+	}
+	if b, _ := fs.ReadFile(mem, "objects/Bag.ba9001.json"); !strings.Contains(string(b), `"GUID": "ba9001"`) {
+		t.Errorf("want the original bag left alone, got %s", b)
+	}
+}
+
+func TestSync(t *testing.T) {
+	m, err := ttsjson.UnmarshalObject([]byte(bagSave))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := file.NewMemFS()
+	opts := Options{FS: mem}
+	if err := Reverse(context.Background(), &Mod{Data: m}, opts); err != nil {
+		t.Fatalf("Reverse() : %v", err)
+	}
+	s, err := NewSyncer(opts, nil)
+	if err != nil {
+		t.Fatalf("NewSyncer() : %v", err)
+	}
+
+	// the bag moved and lost its card, and the box is new.
+	moved := strings.Replace(bagSave, `"Name": "Bag",`, `"Name": "Bag", "Transform": {"posX": 1},`, 1)
+	moved = strings.Replace(moved, `{"GUID": "abc123", "Name": "Card", "Nickname": "Ace"}`, ``, 1)
+	moved = strings.Replace(moved, `getObjectFromGUID('abc123')`, `getObjectFromGUID('b0c001')`, 1)
+	m, err = ttsjson.UnmarshalObject([]byte(moved))
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced, err := s.Sync(context.Background(), &Mod{Data: m}, false)
+	if err != nil {
+		t.Fatalf("Sync() : %v", err)
+	}
+	got := []string{}
+	for _, c := range synced.Objects {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"changed objects/Bag.ba9001.json (Bag): ContainedObjects, LuaScript, Transform",
+		"removed objects/ba9001/Card.abc123.json (Ace)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q got %q", want, got)
+	}
+
+	// someone edits the tree before the next save.
+	if err := mem.WriteFile("src/Bag.ba9001.ttslua", []byte("-- mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Sync(context.Background(), &Mod{Data: m}, false)
+	var conflict *SyncConflictError
+	if !errors.As(err, &conflict) || len(conflict.Changes) != 1 || conflict.Changes[0] != (FileChange{File: "src/Bag.ba9001.ttslua", Op: Changed}) {
+		t.Errorf("want a conflict for src/Bag.ba9001.ttslua, got %v", err)
+	}
+	if b, _ := fs.ReadFile(mem, "src/Bag.ba9001.ttslua"); string(b) != "-- mine" {
+		t.Errorf("want the edit kept, got %s", b)
+	}
+	if changes, err := s.Changes(); err != nil || len(changes) != 1 {
+		t.Errorf("want the edit listed, got %v, %v", changes, err)
+	}
+
+	// the script requires a module, and the save's script doesn't match it.
+	if err := mem.MkdirAll("src/lib", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.WriteFile("src/lib/util.ttslua", []byte("x = 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.WriteFile("src/Bag.ba9001.ttslua", []byte(`require("lib/util")`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	synced, err = s.Sync(context.Background(), &Mod{Data: m}, true)
+	if err != nil {
+		t.Fatalf("Sync() : %v", err)
+	}
+	if len(synced.Conflicts) != 1 || synced.Conflicts[0].File != "Bag.ba9001.ttslua" {
+		t.Errorf("want a conflict for Bag.ba9001.ttslua, got %v", synced.Conflicts)
+	}
+	if b, _ := fs.ReadFile(mem, "src/Bag.ba9001.ttslua"); string(b) != `require("lib/util")` {
+		t.Errorf("want the script kept, got %s", b)
+	}
+	if changes, err := s.Changes(); err != nil || len(changes) != 0 {
+		t.Errorf("want no changes since the sync, got %v, %v", changes, err)
+	}
+}
+
+func TestImport(t *testing.T) {
+	m, err := ttsjson.UnmarshalObject([]byte(strings.Replace(bagSave, `"SaveName": "Test",`, `"SaveName": "Test", "ComponentTags": {"labels": [{"displayed": "Dice", "normalized": "dice"}]},`, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := file.NewMemFS()
+	opts := Options{FS: mem}
+	if err := Reverse(context.Background(), &Mod{Data: m}, opts); err != nil {
+		t.Fatalf("Reverse() : %v", err)
+	}
+	other, err := ttsjson.UnmarshalObject([]byte(`{"ObjectStates": [
+  {"GUID": "abc123", "Name": "Custom_Model", "Nickname": "Dice Tower", "Tags": ["Dice", "Tower"],
+   "LuaScript": "local me, pdf = 'abc123', 'b0c001'",
+   "CustomMesh": {"MeshURL": "http://example.com/tower.obj", "DiffuseURL": ""},
+   "CustomUIAssets": [{"Name": "icon", "Type": 0, "URL": "http://example.com/icon.png"}],
+   "AttachedDecals": [{"CustomDecal": {"Name": "logo", "ImageURL": "http://example.com/logo.png"}}],
+   "ChildObjects": [
+     {"GUID": "b0c001", "Name": "Custom_PDF", "LuaScript": "local me = 'b0c001'",
+      "CustomPDF": {"PDFUrl": "http://example.com/rules.pdf"}}
+   ]},
+  {"GUID": "ddd444", "Name": "Card"}
+]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel, err := selector.Parse([]string{"name:Dice Tower"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := Import(context.Background(), &Mod{Data: other}, sel, "", opts)
+	if err != nil {
+		t.Fatalf("Import() : %v", err)
+	}
+	if want := []string{"Custom_Model.abc124.json"}; !reflect.DeepEqual(imported.Files, want) {
+		t.Errorf("want files %v got %v", want, imported.Files)
+	}
+	if want := []string{"http://example.com/icon.png", "http://example.com/logo.png", "http://example.com/rules.pdf", "http://example.com/tower.obj"}; !reflect.DeepEqual(imported.Assets, want) {
+		t.Errorf("want assets %v got %v", want, imported.Assets)
+	}
+	if want := []string{"Tower"}; !reflect.DeepEqual(imported.NewTags, want) {
+		t.Errorf("want new tags %v got %v", want, imported.NewTags)
+	}
+	b, _ := fs.ReadFile(mem, "objects/Custom_Model.abc124.json")
+	if !strings.Contains(string(b), `"LuaScript": "local me, pdf = 'abc124', 'b0c002'"`) {
+		t.Errorf("want the script to refer to the new GUIDs, got %s", b)
+	}
+	// the attached PDF's GUID collided with the box's.
+	if !strings.Contains(string(b), `"GUID": "b0c002"`) || !strings.Contains(string(b), `"LuaScript": "local me = 'b0c002'"`) {
+		t.Errorf("want the attached object to get a new GUID, got %s", b)
+	}
+
+	sel, _ = selector.Parse([]string{"tag:Missing"})
+	if _, err := Import(context.Background(), &Mod{Data: other}, sel, "", opts); !errors.Is(err, ErrNoObject) {
+		t.Errorf("want ErrNoObject, got %v", err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	m, err := ttsjson.UnmarshalObject([]byte(`{
+  "SaveName": "Test",
+  "SkyURL": "http://example.com/sky.png",
+  "LuaScript": "function onLoad() print('a long enough Global script') end",
+  "XmlUI": "<Panel id='score'/>",
+  "ObjectStates": [
+    {"GUID": "aaa111", "Name": "Custom_Model", "Nickname": "Dice Tower",
+     "LuaScript": "function onLoad() getObjectFromGUID('b0c001').highlightOn('Red') end"},
+    {"GUID": "b0c001", "Name": "Box",
+     "LuaScript": "function onLoad() getObjectFromGUID(\"CCC333\").flip() end"},
+    {"GUID": "ccc333", "Name": "Card",
+     "LuaScript": "function onLoad() getObjectFromGUID(GUIDS.Rules).flip() end"},
+    {"GUID": "ddd444", "Name": "Deck"},
+    {"GUID": "eee555", "Name": "Notecard", "Nickname": "Rules"}
+  ]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := file.NewMemFS()
+	opts := Options{FS: mem}
+	if err := Reverse(context.Background(), &Mod{Data: m}, opts); err != nil {
+		t.Fatalf("Reverse() : %v", err)
+	}
+	for _, tc := range []struct {
+		args []string
+		x    ExtractOptions
+		want []string
+	}{
+		{args: []string{"name:Dice Tower"}, want: []string{"aaa111"}},
+		{args: []string{"name:Dice Tower"}, x: ExtractOptions{Referenced: true}, want: []string{"aaa111", "b0c001", "ccc333", "eee555"}},
+		{args: []string{"type:D*", "path:objects/Card.ccc333.json"}, want: []string{"ddd444", "ccc333"}},
+		{args: []string{"ddd444", "path:Deck.ddd444"}, x: ExtractOptions{StubGlobal: true}, want: []string{"ddd444"}},
+	} {
+		sel, err := selector.Parse(tc.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x, err := Extract(context.Background(), opts, sel, tc.x)
+		if err != nil {
+			t.Fatalf("Extract(%v) : %v", tc.args, err)
+		}
+		got := []string{}
+		objs, _ := x.Data.Array("ObjectStates")
+		for _, raw := range objs {
+			g, _ := raw.(*ttsjson.Object).String("GUID")
+			got = append(got, g)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v : want %v got %v", tc.args, tc.want, got)
+		}
+		if sky, _ := x.Data.String("SkyURL"); sky != "http://example.com/sky.png" {
+			t.Errorf("%v : want the sky kept, got %q", tc.args, sky)
+		}
+		script, _ := x.Data.String("LuaScript")
+		xml, _ := x.Data.String("XmlUI")
+		if tc.x.StubGlobal && (script != StubScript || xml != "") {
+			t.Errorf("%v : want Global stubbed, got %q and %q", tc.args, script, xml)
+		}
+		if !tc.x.StubGlobal && !strings.Contains(script, "Global script") {
+			t.Errorf("%v : want Global's script kept, got %q", tc.args, script)
+		}
+	}
+
+	sel, _ := selector.Parse([]string{"tag:Missing"})
+	if _, err := Extract(context.Background(), opts, sel, ExtractOptions{}); !errors.Is(err, ErrNoObject) {
+		t.Errorf("want ErrNoObject, got %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package modcreator
+
+import (
+	"ModCreator/file"
+	"ModCreator/guids"
+	"ModCreator/objects"
+	"ModCreator/regui"
+	"ModCreator/saves"
+	"ModCreator/selector"
+	"ModCreator/ttsjson"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var validGUID = regexp.MustCompile(`^[0-9a-fA-F]{6}$`)
+
+// ErrNoObject is wrapped by the errors of FindObject when nothing matches.
+var ErrNoObject = errors.New("no such object")
+
+// Imported describes what ImportObject wrote.
+type Imported struct {
+	// Files lists the object files written for the imported objects,
+	// relative to the objects folder.
+	Files []string
+	// Changes lists the GUIDs reassigned because the tree already used them.
+	Changes []regui.Change
+	// Assets lists the URLs of the meshes, images and asset bundles the
+	// objects use, sorted.
+	Assets []string
+	// Tags lists the tags of the objects, and NewTags those the mod's
+	// ComponentTags doesn't have a label for yet.
+	Tags    []string
+	NewTags []string
+}
+
+// FindObject resolves sel to an object file, relative to the objects folder.
+// sel is the path of the file, with or without .json and the objects folder,
+// or the GUID of a single object.
+func FindObject(opts Options, sel string) (string, error) {
+	opts = opts.withDefaults()
+	objFS, err := opts.sub(opts.ObjectsSubdir)
+	if err != nil {
+		return "", err
+	}
+	rel := strings.TrimPrefix(path.Clean(strings.ReplaceAll(sel, "\\", "/")), opts.ObjectsSubdir+"/")
+	for _, f := range []string{rel, rel + ".json"} {
+		if fi, err := fs.Stat(objFS, f); err == nil && !fi.IsDir() {
+			return f, nil
+		}
+	}
+	if !validGUID.MatchString(sel) {
+		return "", fmt.Errorf("%s : %w", sel, ErrNoObject)
+	}
+	prev, err := objects.ReadPrevious(objFS)
+	if err != nil {
+		return "", &FileError{File: opts.name(opts.ObjectsSubdir), Err: err}
+	}
+	found := prev.Find(sel)
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("GUID %s : %w", sel, ErrNoObject)
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("GUID %s is used by %v objects, choose one by path: %s", sel, len(found), strings.Join(found, ", "))
+}
+
+// ExportObject builds the object sel selects, as for FindObject, and the
+// objects it contains into a TTS Saved Object, with scripts expanded as Build
+// expands them. The returned Mod's Data is the Saved Object file.
+func ExportObject(ctx context.Context, opts Options, sel string) (*Mod, error) {
+	opts = opts.withDefaults()
+	f, err := FindObject(opts, sel)
+	if err != nil {
+		return nil, err
+	}
+	lua, _, info, err := prepare(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	objFS, err := opts.sub(opts.ObjectsSubdir)
+	if err != nil {
+		return nil, err
+	}
+	o, err := objects.ParseObject(objFS, lua, f, nil)
+	if err != nil {
+		return nil, &FileError{File: opts.name(path.Join(opts.ObjectsSubdir, f)), Err: err}
+	}
+	guids.StripScriptNames([]interface{}{o})
+	return &Mod{Data: saves.SavedObject(o), Lua: lua, Info: info}, nil
+}
+
+// ImportObject reverses the objects of save, a Saved Object or any other save,
+// into the tree at into: a folder under the objects folder ("" for the top
+// one), or an object (as for FindObject) to put them inside. Objects whose GUID
+// the tree already uses get a new one, and their scripts are updated to
+// match. save is left unchanged.
+func ImportObject(ctx context.Context, save *ttsjson.Object, into string, opts Options) (*Imported, error) {
+	opts = opts.withDefaults()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	w, err := opts.writable()
+	if err != nil {
+		return nil, err
+	}
+	objFS := file.Sub(w, opts.ObjectsSubdir)
+	if err := objFS.MkdirAll(".", 0755); err != nil {
+		return nil, &FileError{File: opts.name(opts.ObjectsSubdir), Err: err}
+	}
+	dir, err := importDir(opts, objFS, into)
+	if err != nil {
+		return nil, err
+	}
+
+	// importing changes GUIDs and moves values out of the objects as it goes,
+	// so it works on a copy.
+	b, err := ttsjson.Marshal(save)
+	if err != nil {
+		return nil, fmt.Errorf("ttsjson.Marshal(<save>) : %v", err)
+	}
+	cp, err := ttsjson.UnmarshalObject(b)
+	if err != nil {
+		return nil, fmt.Errorf("ttsjson.UnmarshalObject(<save>) : %v", err)
+	}
+	objs, err := saves.Objects(cp)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := objects.ReadObjectStates(objFS)
+	if err != nil {
+		return nil, &FileError{File: opts.name(opts.ObjectsSubdir), Err: err}
+	}
+	raw := toInterfaces(objs)
+	imported := &Imported{Changes: regui.Reassign(raw, guids.Collect(existing))}
+	// printing moves contained objects out of their containers, so look
+	// first.
+	imported.Assets, imported.Tags = assets(raw)
+
+	textFiles := []string{}
+	textFS := file.Sub(w, opts.TextSubdir)
+	err = fs.WalkDir(textFS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			textFiles = append(textFiles, p)
+		}
+		return err
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, &FileError{File: opts.name(opts.TextSubdir), Err: err}
+	}
+	pol, err := readPolicy(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := textFS.MkdirAll(".", 0755); err != nil {
+		return nil, &FileError{File: opts.name(opts.TextSubdir), Err: err}
+	}
+	printed, err := objects.AddObjectStates(objFS, file.NewLuaOpsFS(textFS), dir, objs, pol, opts.Naming, textFiles)
+	if err != nil {
+		return nil, &FileError{File: opts.name(path.Join(opts.ObjectsSubdir, dir)), Err: err}
+	}
+	for _, f := range printed.Order {
+		imported.Files = append(imported.Files, path.Join(dir, f))
+	}
+	labels := componentTags(opts)
+	for _, t := range imported.Tags {
+		if !labels[strings.ToLower(t)] {
+			imported.NewTags = append(imported.NewTags, t)
+		}
+	}
+	if len(printed.Conflicts) > 0 {
+		return imported, &ConflictError{Conflicts: printed.Conflicts}
+	}
+	return imported, nil
+}
+
+// Import reverses the objects of mod sel selects, and the objects they
+// contain, into the tree at into, as ImportObject does.
+func Import(ctx context.Context, mod *Mod, sel selector.Selector, into string, opts Options) (*Imported, error) {
+	if len(sel.Paths) > 0 {
+		return nil, fmt.Errorf("path: selects files of a config directory, which another mod doesn't have")
+	}
+	objs, _ := mod.Data.Array(objectStates)
+	picked := sel.Pick(objs)
+	if len(picked) == 0 {
+		return nil, fmt.Errorf("nothing in the mod matches : %w", ErrNoObject)
+	}
+	return ImportObject(ctx, saves.SavedObject(picked...), into, opts)
+}
+
+// assets lists the asset URLs and the tags of objs and the objects they
+// contain, each sorted.
+func assets(objs []interface{}) ([]string, []string) {
+	urls := map[string]bool{}
+	tags := map[string]bool{}
+	var walkURLs func(k string, v interface{})
+	walkURLs = func(k string, v interface{}) {
+		switch val := v.(type) {
+		case string:
+			// like ImageURL, PDFUrl or the URL of a CustomUIAssets entry.
+			if strings.HasSuffix(strings.ToLower(k), "url") && strings.TrimSpace(val) != "" {
+				urls[val] = true
+			}
+		case *ttsjson.Object:
+			// like CustomMesh, CustomImage or the decks of CustomDeck.
+			for _, k := range val.Keys() {
+				// objects.Walk visits the objects these hold.
+				if k != "States" && k != "ContainedObjects" && k != "ChildObjects" {
+					sub, _ := val.Get(k)
+					walkURLs(k, sub)
+				}
+			}
+		case []interface{}:
+			// like AttachedDecals or CustomUIAssets.
+			for _, e := range val {
+				walkURLs(k, e)
+			}
+		}
+	}
+	objects.Walk(objs, func(o *ttsjson.Object) {
+		walkURLs("", o)
+		raw, _ := o.Array("Tags")
+		for _, t := range raw {
+			if tag, ok := t.(string); ok {
+				tags[tag] = true
+			}
+		}
+	})
+	return sortedKeys(urls), sortedKeys(tags)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// componentTags is the set of normalized tags the ComponentTags of the config
+// directory has labels for.
+func componentTags(opts Options) map[string]bool {
+	labels := map[string]bool{}
+	c, err := readConfig(opts)
+	if err != nil {
+		return labels
+	}
+	ct, ok := c.Object("ComponentTags")
+	if p, isPath := c.String("ComponentTags" + pathExt); isPath {
+		jsonFS, err := opts.sub(opts.JSONSubdir)
+		if err != nil {
+			return labels
+		}
+		if ct, err = file.NewJSONOpsFS(jsonFS).ReadObj(p); err != nil {
+			return labels
+		}
+		ok = true
+	}
+	if !ok {
+		return labels
+	}
+	raw, _ := ct.Array("labels")
+	for _, l := range raw {
+		if label, ok := l.(*ttsjson.Object); ok {
+			n, _ := label.String("normalized")
+			labels[n] = true
+		}
+	}
+	return labels
+}
+
+// importDir is the folder of objFS which objects imported into into go in,
+// giving a container its folder if it had none.
+func importDir(opts Options, objFS file.WriteFS, into string) (string, error) {
+	rel := strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(into, "\\", "/")), "/")
+	rel = strings.TrimPrefix(strings.TrimPrefix(rel, opts.ObjectsSubdir), "/")
+	if rel == "" {
+		return ".", nil
+	}
+	if fi, err := fs.Stat(objFS, rel); err == nil && fi.IsDir() {
+		return rel, nil
+	}
+	f, err := FindObject(opts, into)
+	if err != nil {
+		return "", err
+	}
+	b, err := fs.ReadFile(objFS, f)
+	if err != nil {
+		return "", &FileError{File: opts.name(path.Join(opts.ObjectsSubdir, f)), Err: err}
+	}
+	container, err := ttsjson.UnmarshalObject(b)
+	if err != nil {
+		return "", &FileError{File: opts.name(path.Join(opts.ObjectsSubdir, f)), Err: err}
+	}
+	if sub, ok := container.String("ContainedObjects" + pathExt); ok && sub != "" {
+		return path.Join(path.Dir(f), sub), nil
+	}
+	// a container without anything in it yet gets a folder named after its
+	// GUID, as reversing names them.
+	entries, err := fs.ReadDir(objFS, path.Dir(f))
+	if err != nil {
+		return "", &FileError{File: opts.name(path.Join(opts.ObjectsSubdir, path.Dir(f))), Err: err}
+	}
+	taken := map[string]bool{}
+	for _, e := range entries {
+		taken[strings.ToLower(e.Name())] = true
+	}
+	guid, _ := container.String("GUID")
+	sub := guid
+	for n := 1; sub == "" || taken[strings.ToLower(sub)]; n++ {
+		sub = fmt.Sprintf("%s_%v", guid, n)
+	}
+	container.Rename("ContainedObjects", "ContainedObjects"+pathExt)
+	container.Set("ContainedObjects"+pathExt, sub)
+	if b, err = ttsjson.Marshal(container); err != nil {
+		return "", fmt.Errorf("ttsjson.Marshal(%s) : %v", f, err)
+	}
+	if err := file.WriteIfChanged(objFS, f, b); err != nil {
+		return "", &FileError{File: opts.name(path.Join(opts.ObjectsSubdir, f)), Err: err}
+	}
+	return path.Join(path.Dir(f), sub), nil
+}
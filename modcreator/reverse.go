@@ -0,0 +1,133 @@
+package modcreator
+
+import (
+	"ModCreator/file"
+	"ModCreator/objects"
+	"ModCreator/policy"
+	"ModCreator/reverse"
+	"ModCreator/ttsjson"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConflictError is returned by Reverse when it wrote the config directory, but
+// couldn't keep some of the names it had before.
+type ConflictError struct {
+	Conflicts []objects.Conflict
+}
+
+func (e *ConflictError) Error() string {
+	lines := []string{}
+	for _, c := range e.Conflicts {
+		lines = append(lines, c.String())
+	}
+	return fmt.Sprintf("%v conflicts:\n%s", len(e.Conflicts), strings.Join(lines, "\n"))
+}
+
+// ReadMod reads a TTS mod file.
+func ReadMod(filename string) (*Mod, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, &FileError{File: filename, Err: err}
+	}
+	data, err := ttsjson.UnmarshalObject(b)
+	if err != nil {
+		return nil, &FileError{File: filename, Err: err}
+	}
+	return &Mod{Data: data}, nil
+}
+
+// Reverse writes mod into the config directory, creating it as needed. A
+// directory reversed into before is updated in place, keeping its file names;
+// a *ConflictError lists any it couldn't keep. mod is left unchanged.
+func Reverse(ctx context.Context, mod *Mod, opts Options) error {
+	opts = opts.withDefaults()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	w, err := opts.writable()
+	if err != nil {
+		return err
+	}
+	for _, s := range []string{opts.TextSubdir, opts.JSONSubdir, opts.ObjectsSubdir} {
+		if err := w.MkdirAll(s, 0777); err != nil {
+			return &FileError{File: opts.name(s), Err: err}
+		}
+	}
+	// reversing moves values out of the mod as it goes, so it works on a
+	// copy.
+	b, err := ttsjson.Marshal(mod.Data)
+	if err != nil {
+		return fmt.Errorf("ttsjson.Marshal(<mod>) : %v", err)
+	}
+	raw, err := ttsjson.UnmarshalObject(b)
+	if err != nil {
+		return fmt.Errorf("ttsjson.UnmarshalObject(<mod>) : %v", err)
+	}
+
+	lua := file.NewLuaOpsFS(file.Sub(w, opts.TextSubdir))
+	j := file.NewJSONOpsFS(file.Sub(w, opts.JSONSubdir))
+	if c, err := readConfig(opts); err == nil {
+		// keep the project's preprocessor symbols, and use them to tell
+		// whether scripts with directives are unchanged.
+		if d, ok := c.Get(definesKey); ok {
+			raw.Set(definesKey, d)
+		}
+		if err := defineSymbols(c, lua, opts.Defines); err != nil {
+			return &FileError{File: opts.name(ConfigFile), Err: err}
+		}
+	}
+	pol, err := readPolicy(opts)
+	if err != nil {
+		return err
+	}
+	conflicts, err := reverse.Write(raw, reverse.Options{
+		Lua:           lua,
+		JSON:          j,
+		FS:            w,
+		ConfigFile:    ConfigFile,
+		ObjectsSubdir: opts.ObjectsSubdir,
+		StringKeys:    opts.StringKeys,
+		ObjectKeys:    opts.ObjectKeys,
+		ArrayKeys:     opts.ArrayKeys,
+		Policy:        pol,
+		Naming:        opts.Naming,
+	})
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// readPolicy returns the policy of opts, reading it from a policy file if
+// there is one.
+func readPolicy(opts Options) (*policy.Policy, error) {
+	if opts.Policy != nil {
+		return opts.Policy, nil
+	}
+	def := policy.Default(opts.StringKeys, opts.ObjectKeys, opts.ArrayKeys)
+	if p := opts.PolicyFile; p != "" {
+		pol, err := policy.Read(os.DirFS(filepath.Dir(p)), filepath.Base(p), def)
+		if err != nil {
+			return nil, &FileError{File: p, Err: err}
+		}
+		return pol, nil
+	}
+	if _, err := fs.Stat(opts.FS, PolicyFile); errors.Is(err, fs.ErrNotExist) {
+		return def, nil
+	}
+	pol, err := policy.Read(opts.FS, PolicyFile, def)
+	if err != nil {
+		return nil, &FileError{File: opts.name(PolicyFile), Err: err}
+	}
+	return pol, nil
+}
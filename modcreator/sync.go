@@ -0,0 +1,340 @@
+package modcreator
+
+import (
+	"ModCreator/guids"
+	"ModCreator/objects"
+	"ModCreator/ttsjson"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Ops of a FileChange or ObjectChange.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Snapshot holds the content of the files of a config directory which
+// reversing writes, keyed by their path in it.
+type Snapshot map[string]string
+
+// FileChange is a file which differs between two snapshots.
+type FileChange struct {
+	File string
+	Op   string
+}
+
+func (c FileChange) String() string {
+	return fmt.Sprintf("%s %s", c.Op, c.File)
+}
+
+// ObjectChange is an object whose file, or any file its values were written
+// to, differs between two snapshots.
+type ObjectChange struct {
+	// File is the object's file in the config directory.
+	File string
+	GUID string
+	Name string
+	Op   string
+	// Keys lists the fields which changed, for a changed object.
+	Keys []string
+}
+
+func (c ObjectChange) String() string {
+	s := fmt.Sprintf("%s %s", c.Op, c.File)
+	if c.Name != "" {
+		s += fmt.Sprintf(" (%s)", c.Name)
+	}
+	if len(c.Keys) > 0 {
+		s += ": " + strings.Join(c.Keys, ", ")
+	}
+	return s
+}
+
+// Synced describes what one Sync changed.
+type Synced struct {
+	Objects []ObjectChange
+	// Files lists the other changed files, like config.json or Global's
+	// script.
+	Files []FileChange
+	// Conflicts lists what Reverse couldn't keep, like names, or scripts
+	// whose requires no longer build into the save's script and which were
+	// left unchanged.
+	Conflicts []objects.Conflict
+}
+
+// SyncConflictError is returned by Sync when the config directory changed
+// since the last sync, so reversing could overwrite someone's work.
+type SyncConflictError struct {
+	Changes []FileChange
+}
+
+func (e *SyncConflictError) Error() string {
+	lines := []string{}
+	for _, c := range e.Changes {
+		lines = append(lines, "  "+c.String())
+	}
+	return fmt.Sprintf("%v files changed since the last sync:\n%s", len(e.Changes), strings.Join(lines, "\n"))
+}
+
+// SyncState records the files of a config directory as a sync left them, by
+// the sha256 of their content, to be kept between runs.
+type SyncState map[string]string
+
+// State is the SyncState of the files of snap.
+func (snap Snapshot) State() SyncState {
+	state := SyncState{}
+	for f, content := range snap {
+		state[f] = fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	}
+	return state
+}
+
+// Syncer reverses each new version of a save into a config directory, as long
+// as nobody changed the directory in between.
+type Syncer struct {
+	opts Options
+	last SyncState
+}
+
+// NewSyncer starts syncing into the config directory of opts, which last
+// synced to last. A nil last takes the directory as it is now.
+func NewSyncer(opts Options, last SyncState) (*Syncer, error) {
+	opts = opts.withDefaults()
+	if last == nil {
+		snap, err := TakeSnapshot(opts)
+		if err != nil {
+			return nil, err
+		}
+		last = snap.State()
+	}
+	return &Syncer{opts: opts, last: last}, nil
+}
+
+// State is the config directory as the last sync left it.
+func (s *Syncer) State() SyncState {
+	return s.last
+}
+
+// Changes lists the files of the config directory which differ from the last
+// sync.
+func (s *Syncer) Changes() ([]FileChange, error) {
+	snap, err := TakeSnapshot(s.opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.last.Diff(snap.State()), nil
+}
+
+// Sync reverses mod over the config directory in place, and describes what
+// that changed. Should the directory differ from the last sync, nothing is
+// written and a *SyncConflictError lists the differences, unless force is set.
+func (s *Syncer) Sync(ctx context.Context, mod *Mod, force bool) (*Synced, error) {
+	before, err := TakeSnapshot(s.opts)
+	if err != nil {
+		return nil, err
+	}
+	if changes := s.last.Diff(before.State()); len(changes) > 0 && !force {
+		return nil, &SyncConflictError{Changes: changes}
+	}
+	synced := &Synced{}
+	err = Reverse(ctx, mod, s.opts)
+	var conflicts *ConflictError
+	if errors.As(err, &conflicts) {
+		synced.Conflicts = conflicts.Conflicts
+	} else if err != nil {
+		return nil, err
+	}
+	after, err := TakeSnapshot(s.opts)
+	if err != nil {
+		return nil, err
+	}
+	s.last = after.State()
+	synced.Objects, synced.Files = s.describe(before, after, before.State().Diff(s.last))
+	return synced, nil
+}
+
+// TakeSnapshot reads config.json, the policy file and every file of the
+// text, json and objects folders, except the generated GUID module.
+func TakeSnapshot(opts Options) (Snapshot, error) {
+	opts = opts.withDefaults()
+	snap := Snapshot{}
+	for _, f := range []string{ConfigFile, PolicyFile} {
+		b, err := fs.ReadFile(opts.FS, f)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, &FileError{File: opts.name(f), Err: err}
+		}
+		snap[f] = string(b)
+	}
+	skip := path.Join(opts.TextSubdir, guids.ModuleName+".ttslua")
+	for _, dir := range []string{opts.TextSubdir, opts.JSONSubdir, opts.ObjectsSubdir} {
+		err := fs.WalkDir(opts.FS, dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || p == skip {
+				return err
+			}
+			b, err := fs.ReadFile(opts.FS, p)
+			if err != nil {
+				return err
+			}
+			snap[p] = string(b)
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, &FileError{File: opts.name(dir), Err: err}
+		}
+	}
+	return snap, nil
+}
+
+// Diff lists the files added, removed or changed from a to b, sorted.
+func (a SyncState) Diff(b SyncState) []FileChange {
+	changes := []FileChange{}
+	for f, content := range b {
+		if old, ok := a[f]; !ok {
+			changes = append(changes, FileChange{File: f, Op: Added})
+		} else if old != content {
+			changes = append(changes, FileChange{File: f, Op: Changed})
+		}
+	}
+	for f := range a {
+		if _, ok := b[f]; !ok {
+			changes = append(changes, FileChange{File: f, Op: Removed})
+		}
+	}
+	sort.Slice(changes, func(i, k int) bool { return changes[i].File < changes[k].File })
+	return changes
+}
+
+// describe groups changes by object: the object files themselves, and the
+// text files their values were written to. Anything else is returned as it
+// is.
+func (s *Syncer) describe(before, after Snapshot, changes []FileChange) ([]ObjectChange, []FileChange) {
+	objs := map[string]*ObjectChange{}
+	order := []string{}
+	change := func(f, op string) *ObjectChange {
+		c, ok := objs[f]
+		if !ok {
+			c = &ObjectChange{File: f, Op: op}
+			objs[f] = c
+			order = append(order, f)
+		}
+		return c
+	}
+	// users maps each text file to the fields of the objects written to it.
+	users := map[string][]struct{ file, key string }{}
+	for _, snap := range []Snapshot{after, before} {
+		for f, content := range snap {
+			if !strings.HasPrefix(f, s.opts.ObjectsSubdir+"/") {
+				continue
+			}
+			o, err := ttsjson.UnmarshalObject([]byte(content))
+			if err != nil {
+				continue
+			}
+			for _, k := range o.Keys() {
+				v, ok := o.String(k)
+				key := strings.TrimSuffix(k, pathExt)
+				if !ok || key == k || key == "ContainedObjects" {
+					continue
+				}
+				t := path.Join(s.opts.TextSubdir, v)
+				users[t] = append(users[t], struct{ file, key string }{f, key})
+			}
+		}
+	}
+
+	other := []FileChange{}
+	for _, fc := range changes {
+		if strings.HasPrefix(fc.File, s.opts.ObjectsSubdir+"/") {
+			c := change(fc.File, fc.Op)
+			c.Op = fc.Op
+			if fc.Op == Changed {
+				c.Keys = append(c.Keys, changedKeys(before[fc.File], after[fc.File])...)
+			}
+			continue
+		}
+		if len(users[fc.File]) == 0 {
+			other = append(other, fc)
+			continue
+		}
+		for _, u := range users[fc.File] {
+			c := change(u.file, Changed)
+			if c.Op == Changed {
+				c.Keys = append(c.Keys, u.key)
+			}
+		}
+	}
+
+	result := []ObjectChange{}
+	sort.Strings(order)
+	for _, f := range order {
+		c := objs[f]
+		content, ok := after[f]
+		if !ok {
+			content = before[f]
+		}
+		if o, err := ttsjson.UnmarshalObject([]byte(content)); err == nil {
+			c.GUID, _ = o.String("GUID")
+			if c.Name, _ = o.String("Nickname"); c.Name == "" {
+				c.Name, _ = o.String("Name")
+			}
+		}
+		if c.Op == Changed {
+			c.Keys = uniqueSorted(c.Keys)
+		} else {
+			c.Keys = nil
+		}
+		result = append(result, *c)
+	}
+	return result, other
+}
+
+// changedKeys lists the fields of the object file which differ from a to b,
+// leaving out the _path keys naming files.
+func changedKeys(a, b string) []string {
+	oa, err := ttsjson.UnmarshalObject([]byte(a))
+	if err != nil {
+		return nil
+	}
+	ob, err := ttsjson.UnmarshalObject([]byte(b))
+	if err != nil {
+		return nil
+	}
+	keys := []string{}
+	for _, o := range []*ttsjson.Object{oa, ob} {
+		for _, k := range o.Keys() {
+			if strings.HasSuffix(k, pathExt) || strings.HasSuffix(k, "_order") {
+				continue
+			}
+			va, _ := oa.Get(k)
+			vb, _ := ob.Get(k)
+			ba, _ := ttsjson.MarshalCompact(va)
+			bb, _ := ttsjson.MarshalCompact(vb)
+			if string(ba) != string(bb) {
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
+
+func uniqueSorted(s []string) []string {
+	sort.Strings(s)
+	out := []string{}
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package objects
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Naming lists the object fields files are named after, in order of
+// preference. An object's files are named after the first field it has a
+// usable value for, followed by its GUID (like Clue.abc123.json); the field
+// GUID names them after the GUID alone, as does running out of fields.
+type Naming []string
+
+// DefaultNaming names files after an object's Name.
+var DefaultNaming = Naming{"Name"}
+
+// ParseNaming reads a comma separated list of fields, like
+// "Nickname,Name,GUID".
+func ParseNaming(s string) (Naming, error) {
+	n := Naming{}
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" || cleanName(f) != f {
+			return nil, fmt.Errorf("bad naming field %q in %q", f, s)
+		}
+		n = append(n, f)
+	}
+	return n, nil
+}
+
+// base is the name of o's files, without any extension.
+func (n Naming) base(o *objConfig) string {
+	for _, f := range n {
+		if f == "GUID" {
+			break
+		}
+		v, _ := o.data.String(f)
+		if name := cleanName(v); name != "" {
+			return name + "." + o.guid
+		}
+	}
+	return o.guid
+}
+
+// cleanName makes s safe to use in a file name on any system: accents are
+// removed, letters with a latin transliteration are replaced by it, and
+// anything else but ascii letters, digits, _ and - is dropped. Should that
+// leave nothing of a name with letters or digits, like one in a script
+// without a transliteration, it is named after a short hash of s instead.
+func cleanName(s string) string {
+	plain, _, err := transform.String(stripAccents, s)
+	if err != nil {
+		plain = s
+	}
+	var b strings.Builder
+	for _, r := range plain {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+		} else if t, ok := latin[r]; ok {
+			b.WriteString(t)
+		}
+	}
+	if name := unsafeName.ReplaceAllString(b.String(), ""); name != "" || strings.IndexFunc(s, isAlnum) < 0 {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+func isAlnum(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// stripAccents decomposes letters, and drops the marks they are decomposed
+// into.
+var stripAccents = transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// transliterations lists the letters which have no decomposition into ascii,
+// with the latin letters they are written as: either one for all of them,
+// or one each.
+var transliterations = []struct {
+	from string
+	to   []string
+}{
+	{"ĐÐ", []string{"D"}},
+	{"đð", []string{"d"}},
+	{"Ħ", []string{"H"}},
+	{"ħ", []string{"h"}},
+	{"ı", []string{"i"}},
+	{"ĿŁ", []string{"L"}},
+	{"ŀł", []string{"l"}},
+	{"Ø", []string{"O"}},
+	{"ø", []string{"o"}},
+	{"Ŧ", []string{"T"}},
+	{"ŧ", []string{"t"}},
+	{"ÆŒÞß", []string{"AE", "OE", "TH", "ss"}},
+	{"æœþ", []string{"ae", "oe", "th"}},
+	{"ΑΒΓΔΕΖΗΘΙΚΛΜΝΞΟΠΡΣΤΥΦΧΨΩ", []string{"A", "B", "G", "D", "E", "Z", "I", "Th", "I", "K", "L", "M", "N", "X", "O", "P", "R", "S", "T", "Y", "F", "Ch", "Ps", "O"}},
+	{"αβγδεζηθικλμνξοπρσςτυφχψω", []string{"a", "b", "g", "d", "e", "z", "i", "th", "i", "k", "l", "m", "n", "x", "o", "p", "r", "s", "s", "t", "y", "f", "ch", "ps", "o"}},
+	{"АБВГДЕЖЗИКЛМНОПРСТУФХЦЧШЩЪЫЬЭЮЯ", []string{"A", "B", "V", "G", "D", "E", "Zh", "Z", "I", "K", "L", "M", "N", "O", "P", "R", "S", "T", "U", "F", "Kh", "Ts", "Ch", "Sh", "Shch", "", "Y", "", "E", "Yu", "Ya"}},
+	{"абвгдежзиклмнопрстуфхцчшщъыьэюя", []string{"a", "b", "v", "g", "d", "e", "zh", "z", "i", "k", "l", "m", "n", "o", "p", "r", "s", "t", "u", "f", "kh", "ts", "ch", "sh", "shch", "", "y", "", "e", "yu", "ya"}},
+}
+
+// latin transliterates single letters, as transliterations lists them.
+var latin = map[rune]string{}
+
+func init() {
+	for _, set := range transliterations {
+		i := 0
+		for _, r := range set.from {
+			if len(set.to) == 1 {
+				latin[r] = set.to[0]
+			} else if i < len(set.to) {
+				latin[r] = set.to[i]
+			}
+			i++
+		}
+	}
+}
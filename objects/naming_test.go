@@ -0,0 +1,126 @@
+package objects
+
+import (
+	"ModCreator/file"
+	"ModCreator/policy"
+	"ModCreator/ttsjson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCleanName(t *testing.T) {
+	for in, want := range map[string]string{
+		"Clue Token":      "ClueToken",
+		"Héroïne Œuvre":   "HeroineOEuvre",
+		"Straße":          "Strasse",
+		"Мир":             "Mir",
+		"Αθήνα":           "Athina",
+		"Ёлка Йод":        "ElkaIod",
+		"Øresund Łódź":    "OresundLodz",
+		"ﬁve":             "five",
+		"a/b\\c:d*e?f<g>": "abcdefg",
+		"???":             "",
+	} {
+		if got := cleanName(in); got != want {
+			t.Errorf("cleanName(%s) : want %q got %q", in, want, got)
+		}
+	}
+	// names in scripts without a transliteration are named after a hash.
+	for _, in := range []string{"卡牌", "כרטיס", "بطاقة"} {
+		got := cleanName(in)
+		if len(got) != 8 || got != cleanName(in) || got == cleanName("卡") {
+			t.Errorf("cleanName(%s) : want a hash of the name, got %q", in, got)
+		}
+	}
+}
+
+func TestTransliterations(t *testing.T) {
+	for _, set := range transliterations {
+		if len(set.to) > 1 && len(set.to) != utf8.RuneCountInString(set.from) {
+			t.Errorf("%v transliterations for the %v letters of %s", len(set.to), utf8.RuneCountInString(set.from), set.from)
+		}
+	}
+}
+
+func TestParseNaming(t *testing.T) {
+	n, err := ParseNaming("Nickname, Name,GUID")
+	if err != nil || strings.Join(n, ",") != "Nickname,Name,GUID" {
+		t.Errorf("want Nickname,Name,GUID got %v %v", n, err)
+	}
+	for _, bad := range []string{"", "Nickname,", "Nick name"} {
+		if _, err := ParseNaming(bad); err == nil {
+			t.Errorf("want an error for %q", bad)
+		}
+	}
+}
+
+func TestNamingCollisions(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	objs := filepath.Join(root, "objects")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	mk := func(guid, nick, lua string) *ttsjson.Object {
+		o := ttsjson.NewObject()
+		o.Set("GUID", guid)
+		o.Set("Name", "Custom_Tile")
+		o.Set("Nickname", nick)
+		o.Set("LuaScript", strings.Repeat(lua, 100))
+		return o
+	}
+	in := func() []*ttsjson.Object {
+		return []*ttsjson.Object{
+			mk("aaa111", "Forest", "a"),
+			mk("bbb222", "Щит", "b"),
+			// copies sharing a GUID, and nicknames differing by case.
+			mk("ccc333", "Lake", "c"),
+			mk("ccc333", "LAKE", "d"),
+			mk("ddd444", "", "e"),
+		}
+	}
+	list := func(dir string) string {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		sort.Strings(names)
+		return strings.Join(names, ",")
+	}
+	l := file.NewLuaOps(src)
+	naming := Naming{"Nickname", "Name"}
+	for i := 0; i < 2; i++ {
+		// a fresh tree each time, so both runs name everything anew.
+		if err := os.RemoveAll(objs); err != nil {
+			t.Fatal(err)
+		}
+		prev, err := ReadPrevious(file.DirFS(objs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := PrintObjectStates(file.DirFS(objs), l, in(), policy.Default(nil, nil, nil), naming, prev); err != nil {
+			t.Fatalf("PrintObjectStates() : %v", err)
+		}
+		want := "Custom_Tile.ddd444.json,Forest.aaa111.json,LAKE.ccc333_1.json,Lake.ccc333.json,Shchit.bbb222.json"
+		if got := list(objs); got != want {
+			t.Errorf("run %v : want objects %s got %s", i, want, got)
+		}
+		want = "Custom_Tile.ddd444.ttslua,Forest.aaa111.ttslua,LAKE.ccc333_1.ttslua,Lake.ccc333.ttslua,Shchit.bbb222.ttslua"
+		if got := list(src); got != want {
+			t.Errorf("run %v : want src %s got %s", i, want, got)
+		}
+	}
+	b, err := ioutil.ReadFile(filepath.Join(src, "LAKE.ccc333_1.ttslua"))
+	if err != nil || string(b) != strings.Repeat("d", 100) {
+		t.Errorf("want the second copy's own script, got %.10s %v", b, err)
+	}
+}
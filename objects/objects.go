@@ -3,90 +3,109 @@ package objects
 import (
 	"ModCreator/bundler"
 	"ModCreator/file"
+	"ModCreator/policy"
+	"ModCreator/ttsjson"
 	"log"
 	"path"
-	"regexp"
+	"sort"
+	"strings"
 
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
-	"io/ioutil"
-	"os"
 )
 
-type j map[string]interface{}
-type objArray []map[string]interface{}
+const (
+	// OrderKey follows ContainedObjects or ObjectStates in a key listing the
+	// object files of its folder in the order the objects appear in the mod.
+	// Files it leaves out come after, sorted by name.
+	OrderKey = "_order"
+
+	pathExt = "_path"
+)
 
 type objConfig struct {
 	guid               string
-	data               j
+	data               *ttsjson.Object
 	luascriptPath      string
 	luascriptstatePath string
 	subObjDir          string
+	subObjOrder        []string
 	subObj             []*objConfig
+	// prev is where a previous reverse wrote this object, if anywhere.
+	prev *prevObject
 }
 
-func (o *objConfig) parseFromFile(filepath string) error {
-	jFile, err := os.Open(filepath)
-	// if we os.Open returns an error then handle it
+func (o *objConfig) parseFromFile(fsys fs.FS, filepath string) error {
+	b, err := fs.ReadFile(fsys, filepath)
 	if err != nil {
-		return fmt.Errorf("os.Open(%s): %v", filepath, err)
+		return err
 	}
-	defer jFile.Close()
 
-	b, err := ioutil.ReadAll(jFile)
+	o.data, err = ttsjson.UnmarshalObject(b)
 	if err != nil {
-		return err
+		return fmt.Errorf("ttsjson.UnmarshalObject(%s) : %v", filepath, err)
 	}
 
-	json.Unmarshal([]byte(b), &o.data)
-
-	dguid, ok := o.data["GUID"]
+	dguid, ok := o.data.Get("GUID")
 	if !ok {
 		return fmt.Errorf("object at (%s) doesn't have a GUID field", filepath)
 	}
 	guid, ok := dguid.(string)
 	if !ok {
-		return fmt.Errorf("object at (%s) doesn't have a string GUID (%s)", filepath, o.data["GUID"])
+		return fmt.Errorf("object at (%s) doesn't have a string GUID (%s)", filepath, dguid)
 	}
 	o.guid = guid
 
-	// TODO nead ability to read from script folder
-	tryParseIntoStr(&o.data, "LuaScript_path", &o.luascriptPath)
-	tryParseIntoStr(&o.data, "LuaScriptState_path", &o.luascriptstatePath)
-	tryParseIntoStr(&o.data, "ContainedObjects_path", &o.subObjDir)
+	// the _path keys stay put until printing, to keep their place.
+	o.luascriptPath, _ = o.data.String("LuaScript" + pathExt)
+	o.luascriptstatePath, _ = o.data.String("LuaScriptState" + pathExt)
+	o.subObjDir, _ = o.data.String("ContainedObjects" + pathExt)
+	if rawOrder, ok := o.data.Get("ContainedObjects" + OrderKey); ok {
+		o.subObjOrder = toStrings(rawOrder)
+		o.data.Delete("ContainedObjects" + OrderKey)
+	}
 
 	return nil
 }
 
-func tryParseIntoStr(m *j, k string, dest *string) {
-	if raw, ok := (*m)[k]; ok {
-		if str, ok := raw.(string); ok {
-			*dest = str
-			delete((*m), k)
+func toStrings(raw interface{}) []string {
+	strs := []string{}
+	arr, _ := raw.([]interface{})
+	for _, v := range arr {
+		if s, ok := v.(string); ok {
+			strs = append(strs, s)
 		}
 	}
+	return strs
 }
 
-func (o *objConfig) parseFromJSON(data map[string]interface{}) error {
+func (o *objConfig) parseFromJSON(data *ttsjson.Object) error {
 	o.data = data
-	dguid, ok := o.data["GUID"]
+	dguid, ok := o.data.Get("GUID")
 	if !ok {
-		return fmt.Errorf("object (%v) doesn't have a GUID field", data)
+		return fmt.Errorf("object (%v) doesn't have a GUID field", ttsjson.Plain(data))
 	}
 	guid, ok := dguid.(string)
 	if !ok {
-		return fmt.Errorf("object (%v) doesn't have a string GUID (%s)", dguid, o.data["GUID"])
+		return fmt.Errorf("object (%v) doesn't have a string GUID (%s)", dguid, dguid)
 	}
 	o.guid = guid
+	if script, ok := o.data.String("LuaScript"); ok {
+		script, err := bundler.Unbundle(script)
+		if err != nil {
+			return fmt.Errorf("bundler.Unbundle(%s)\n: %v", script, err)
+		}
+		o.data.Set("LuaScript", script)
+	}
 	o.subObj = []*objConfig{}
-	if rawObjs, ok := o.data["ContainedObjects"]; ok {
+	if rawObjs, ok := o.data.Get("ContainedObjects"); ok {
 		rawArr, ok := rawObjs.([]interface{})
 		if !ok {
 			return fmt.Errorf("type mismatch in ContainedObjects : %v", rawArr)
 		}
 		for _, rawSubO := range rawArr {
-			subO, ok := rawSubO.(map[string]interface{})
+			subO, ok := rawSubO.(*ttsjson.Object)
 			if !ok {
 				return fmt.Errorf("type mismatch in ContainedObjects : %v", rawSubO)
 			}
@@ -96,132 +115,144 @@ func (o *objConfig) parseFromJSON(data map[string]interface{}) error {
 			}
 			o.subObj = append(o.subObj, &so)
 		}
-		delete(o.data, "ContainedObjects")
 	}
 	return nil
 }
 
-func (o *objConfig) print(l file.LuaReader) (j, error) {
+func (o *objConfig) print(l file.LuaReader, origins file.ScriptOrigins) (*ttsjson.Object, error) {
+	var lines []file.Origin
 	if o.luascriptPath != "" {
-		encoded, err := l.EncodeFromFile(o.luascriptPath)
+		encoded, fromFile, err := l.ExpandFile(o.luascriptPath)
 		if err != nil {
-			return j{}, fmt.Errorf("l.EncodeFromFile(%s) : %v", o.luascriptPath, err)
+			return nil, fmt.Errorf("l.ExpandFile(%s) : %v", o.luascriptPath, err)
 		}
-		o.data["LuaScript"] = encoded
+		o.data.Rename("LuaScript"+pathExt, "LuaScript")
+		o.data.Set("LuaScript", encoded)
+		lines = fromFile
 	}
 	if o.luascriptstatePath != "" {
-		encoded, err := l.EncodeFromFile(o.luascriptstatePath)
+		encoded, err := l.ReadState(o.luascriptstatePath)
+		if err != nil {
+			return nil, fmt.Errorf("l.ReadState(%s) : %v", o.luascriptstatePath, err)
+		}
+		o.data.Rename("LuaScriptState"+pathExt, "LuaScriptState")
+		o.data.Set("LuaScriptState", encoded)
+	}
+	// any other text field which was written to a file.
+	for _, k := range o.data.Keys() {
+		fname, ok := o.data.String(k)
+		key := strings.TrimSuffix(k, pathExt)
+		if !ok || key == k || key == "LuaScript" || key == "LuaScriptState" || key == "ContainedObjects" {
+			continue
+		}
+		if fname == "" {
+			o.data.Delete(k)
+			continue
+		}
+		encoded, err := l.ReadText(fname)
 		if err != nil {
-			return j{}, fmt.Errorf("l.EncodeFromFile(%s) : %v", o.luascriptstatePath, err)
+			return nil, fmt.Errorf("l.ReadText(%s) : %v", fname, err)
 		}
-		o.data["LuaScriptState"] = encoded
+		o.data.Rename(k, key)
+		o.data.Set(key, encoded)
 	}
 
-	replaced, err := l.ReplaceRequire(o.data["LuaScript"].(string))
-	if o.data["GUID"] == "15bb07" {
-		log.Printf("printing 15bb07 with script <%s>", o.data["LuaScript"])
+	script, _ := o.data.String("LuaScript")
+	if o.guid == "15bb07" {
+		log.Printf("printing 15bb07 with script <%s>", script)
 	}
-	o.data["LuaScript"] = replaced
-	if err != nil {
-		return j{}, fmt.Errorf("l.ReplaceRequire(%s) : %v", o.data["LuaScript"], err)
+	if lines == nil {
+		replaced, inline, err := l.Expand(script)
+		if err != nil {
+			return nil, fmt.Errorf("l.Expand(%s) : %v", script, err)
+		}
+		if _, ok := o.data.Get("LuaScript"); ok || replaced != "" {
+			o.data.Set("LuaScript", replaced)
+		}
+		lines = inline
+	}
+	if origins != nil {
+		origins[o.data] = lines
 	}
 
-	subs := []j{}
+	subs := []interface{}{}
 	for _, sub := range o.subObj {
-		printed, err := sub.print(l)
+		printed, err := sub.print(l, origins)
 		if err != nil {
 			return nil, err
 		}
 		subs = append(subs, printed)
 	}
+	o.data.Delete("ContainedObjects" + OrderKey)
 	if len(subs) > 0 {
-		o.data["ContainedObjects"] = subs
+		o.data.Rename("ContainedObjects"+pathExt, "ContainedObjects")
+		o.data.Set("ContainedObjects", subs)
+	}
+	// drop any _path keys which did not name a file.
+	for _, k := range []string{"LuaScript", "LuaScriptState", "ContainedObjects"} {
+		o.data.Delete(k + pathExt)
 	}
 	return o.data, nil
 }
 
-func (o *objConfig) printToFile(filepath string, l file.LuaWriter) error {
-	// maybe convert LuaScript or LuaScriptState
-	if rawscript, ok := o.data["LuaScript"]; ok {
-		if script, ok := rawscript.(string); ok {
-			script, err := bundler.Unbundle(script)
-			if err != nil {
-				return fmt.Errorf("bundler.Unbundle(%s)\n: %v", script, err)
-			}
-			if len(script) > 80 {
-				createdFile := o.getAGoodFileName() + ".ttslua"
-				o.data["LuaScript_path"] = createdFile
-				l.EncodeToFile(script, createdFile)
-				delete(o.data, "LuaScript")
-			}
-			o.data["LuaScript"] = script
-		}
-	}
-	if rawscript, ok := o.data["LuaScriptState"]; ok {
-		if script, ok := rawscript.(string); ok {
-			if len(script) > 80 {
-				createdFile := o.getAGoodFileName() + ".txt"
-				o.data["LuaScriptState_path"] = createdFile
-				l.EncodeToFile(script, createdFile)
-				delete(o.data, "LuaScriptState")
+// printToFile writes the object, and any objects it contains, into the folder
+// dir under the printer's root. It returns the name of the object's file.
+func (o *objConfig) printToFile(dir string, p *printer) (string, error) {
+	// maybe convert LuaScript, LuaScriptState, XmlUI or any other text field
+	for _, e := range p.files.fields(o) {
+		v, _ := o.data.String(e.key)
+		content, _ := e.file(v)
+		createdFile := p.files.fileFor(e.key, v)
+		if !p.files.written[createdFile] {
+			var mismatch *file.MismatchError
+			if err := p.lua.EncodeToFile(content, createdFile); errors.As(err, &mismatch) {
+				p.conflicts = append(p.conflicts, Conflict{File: createdFile, Message: "builds into a different script than the save's, which is not written over it"})
+			} else if err != nil {
+				return "", fmt.Errorf("l.EncodeToFile(%s) : %v", createdFile, err)
 			}
+			p.files.written[createdFile] = true
 		}
+		o.data.Rename(e.key, e.key+pathExt)
+		o.data.Set(e.key+pathExt, createdFile)
 	}
 
 	// recurse if need be
 	if o.subObj != nil && len(o.subObj) > 0 {
-
-		subDirBase := o.guid
-		err := os.Mkdir(path.Join(filepath, subDirBase), 0644)
-		tries := 0
-		for err != nil && tries < 100 {
-			tries++
-			subDirBase = o.guid + fmt.Sprintf("_%v", tries)
-			err = os.Mkdir(path.Join(filepath, subDirBase), 0644)
+		want := ""
+		if o.prev != nil {
+			want = o.prev.subDir
 		}
-		if tries >= 100 {
-			return fmt.Errorf("could not find sutible name for sub directory for %s; %v", o.guid, err)
+		subDirBase := p.claim(dir, want, o.guid, "")
+		if err := p.fsys.MkdirAll(path.Join(dir, subDirBase), 0755); err != nil {
+			return "", fmt.Errorf("MkdirAll(%s) : %v", path.Join(dir, subDirBase), err)
 		}
-		o.data["ContainedObjects_path"] = subDirBase
+		o.data.Rename("ContainedObjects", "ContainedObjects"+pathExt)
+		o.data.Set("ContainedObjects"+pathExt, subDirBase)
 		o.subObjDir = subDirBase
+		names := []string{}
 		for _, subo := range o.subObj {
-			err = subo.printToFile(path.Join(filepath, subDirBase), l)
+			name, err := subo.printToFile(path.Join(dir, subDirBase), p)
 			if err != nil {
-				return err
+				return "", err
 			}
+			names = append(names, name)
+		}
+		if !sort.StringsAreSorted(names) {
+			o.data.InsertAfter("ContainedObjects"+pathExt, "ContainedObjects"+OrderKey, names)
 		}
 	}
 
 	// print self
-	b, err := json.MarshalIndent(o.data, "", "  ")
-	if err != nil {
-		return err
-	}
-	fname := path.Join(filepath, o.getAGoodFileName()+".json")
-	return ioutil.WriteFile(fname, b, 0644)
-
-}
-
-func (o *objConfig) getAGoodFileName() string {
-	moreUUID := o.guid
-	if o.subObjDir != "" {
-		moreUUID = o.subObjDir
-	}
-	// only let alphanumberic, _, -, be put into names
-	reg, err := regexp.Compile("[^a-zA-Z0-9_-]+")
+	b, err := ttsjson.Marshal(o.data)
 	if err != nil {
-		return moreUUID
+		return "", err
 	}
-	rawName, ok := o.data["Name"]
-	if !ok {
-		return moreUUID
+	want := ""
+	if o.prev != nil {
+		want = o.prev.file
 	}
-	name, ok := rawName.(string)
-	if !ok {
-		return moreUUID
-	}
-	n := reg.ReplaceAllString(name, "")
-	return n + "." + moreUUID
+	fname := p.claim(dir, want, p.files.naming.base(o), ".json")
+	return fname, p.write(path.Join(dir, fname), b)
 }
 
 type db struct {
@@ -239,12 +270,12 @@ func (d *db) addObj(o, parent *objConfig) error {
 	return nil
 }
 
-func (d *db) print(l file.LuaReader) (objArray, error) {
-	var oa objArray
+func (d *db) print(l file.LuaReader, origins file.ScriptOrigins) ([]interface{}, error) {
+	oa := []interface{}{}
 	for _, o := range d.root {
-		printed, err := o.print(l)
+		printed, err := o.print(l, origins)
 		if err != nil {
-			return objArray{}, fmt.Errorf("obj (%s) did not print : %v", o.guid, err)
+			return []interface{}{}, fmt.Errorf("obj (%s) did not print : %v", o.guid, err)
 		}
 		oa = append(oa, printed)
 	}
@@ -260,28 +291,86 @@ func (d *db) print(l file.LuaReader) (objArray, error) {
 // --bar.json (guid=888)
 // --888/
 //    --baz.json (guid=999) << this is a child of bar.json
-func ParseAllObjectStates(root string, l file.LuaReader) ([]map[string]interface{}, error) {
+// fsys is the objects folder, and order lists the files directly in it in the
+// order their objects go in, as PrintObjectStates returned it. The origins of
+// the objects' scripts are recorded in origins, unless it is nil.
+func ParseAllObjectStates(fsys fs.FS, l file.LuaReader, order []string, origins file.ScriptOrigins) ([]interface{}, error) {
 	d := db{}
-	err := parseFolder(root, nil, &d)
+	err := parseFolder(fsys, ".", nil, order, &d)
 	if err != nil {
-		return []map[string]interface{}{}, fmt.Errorf("parseFolder(%s): %v", root, err)
+		return []interface{}{}, fmt.Errorf("parseFolder(.): %v", err)
 	}
-	return d.print(l)
+	return d.print(l, origins)
 }
 
-func parseFolder(p string, parent *objConfig, d *db) error {
-	files, err := ioutil.ReadDir(p)
+// ReadObjectStates parses a folder laid out as described by
+// ParseAllObjectStates without expanding any scripts. Contained objects are
+// nested under ContainedObjects as they would be in a built mod.
+func ReadObjectStates(fsys fs.FS) ([]interface{}, error) {
+	d := db{}
+	err := parseFolder(fsys, ".", nil, nil, &d)
 	if err != nil {
-		return fmt.Errorf("ioutil.ReadDir(%s) : %v", p, err)
+		return nil, fmt.Errorf("parseFolder(.): %v", err)
+	}
+	objs := []interface{}{}
+	for _, o := range d.root {
+		objs = append(objs, o.raw())
+	}
+	return objs, nil
+}
+
+func (o *objConfig) raw() *ttsjson.Object {
+	r := ttsjson.NewObject()
+	for _, k := range o.data.Keys() {
+		switch k {
+		case "LuaScript" + pathExt, "LuaScriptState" + pathExt, "ContainedObjects" + pathExt:
+			continue
+		}
+		v, _ := o.data.Get(k)
+		r.Set(k, v)
+	}
+	if len(o.subObj) > 0 {
+		subs := []interface{}{}
+		for _, sub := range o.subObj {
+			subs = append(subs, sub.raw())
+		}
+		r.Set("ContainedObjects", subs)
 	}
-	folders := make([]fs.FileInfo, 0)
+	return r
+}
+
+// inOrder sorts files so that those named in order come first, as listed.
+func inOrder(files []fs.DirEntry, order []string) {
+	rank := map[string]int{}
+	for i, name := range order {
+		if _, ok := rank[name]; !ok {
+			rank[name] = i
+		}
+	}
+	sort.SliceStable(files, func(a, b int) bool {
+		ra, aok := rank[files[a].Name()]
+		rb, bok := rank[files[b].Name()]
+		if aok && bok {
+			return ra < rb
+		}
+		return aok && !bok
+	})
+}
+
+func parseFolder(fsys fs.FS, p string, parent *objConfig, order []string, d *db) error {
+	files, err := fs.ReadDir(fsys, p)
+	if err != nil {
+		return fmt.Errorf("fs.ReadDir(%s) : %v", p, err)
+	}
+	inOrder(files, order)
+	folders := make([]fs.DirEntry, 0)
 	whoseFolder := map[string]*objConfig{}
 	for _, file := range files {
 		if file.IsDir() {
 			folders = append(folders, file)
 			continue
 		}
-		o, err := parseFile(path.Join(p, file.Name()), parent, d)
+		o, err := parseFile(fsys, path.Join(p, file.Name()), parent, d)
 		if err != nil {
 			return err
 		}
@@ -294,14 +383,16 @@ func parseFolder(p string, parent *objConfig, d *db) error {
 		if !ok {
 			return fmt.Errorf("found folder %s without a peer who claims it", folder.Name())
 		}
-		parseFolder(path.Join(p, folder.Name()), o, d)
+		if err := parseFolder(fsys, path.Join(p, folder.Name()), o, o.subObjOrder, d); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func parseFile(filepath string, parent *objConfig, d *db) (*objConfig, error) {
+func parseFile(fsys fs.FS, filepath string, parent *objConfig, d *db) (*objConfig, error) {
 	var o objConfig
-	err := o.parseFromFile(filepath)
+	err := o.parseFromFile(fsys, filepath)
 	if err != nil {
 		return nil, fmt.Errorf("parseFromFile(%s) : %v", filepath, err)
 	}
@@ -309,19 +400,149 @@ func parseFile(filepath string, parent *objConfig, d *db) (*objConfig, error) {
 	return &o, d.addObj(&o, parent)
 }
 
-// PrintObjectStates takes a list of json objects and prints them in the
-// expected format outlined by ParseAllObjectStates
-func PrintObjectStates(root string, f file.LuaWriter, objs []map[string]interface{}) error {
+// PrintObjectStates takes a list of json objects and prints them into the
+// objects folder fsys, in the format outlined by ParseAllObjectStates. pol
+// decides which text fields are written to files of their own, and naming
+// what new files are named after. Objects which prev already has files for
+// keep those file names and folders; only changed files are rewritten, and
+// files of objects no longer in objs are deleted.
+func PrintObjectStates(fsys file.WriteFS, f file.LuaWriter, objs []*ttsjson.Object, pol *policy.Policy, naming Naming, prev *Previous) (*Printed, error) {
+	ocs := []*objConfig{}
+	files := newSharedFiles(pol, naming)
 	for _, rootObj := range objs {
 		oc := objConfig{}
 		err := oc.parseFromJSON(rootObj)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		err = oc.printToFile(root, f)
+		prev.match(&oc, ".")
+		files.collect(&oc)
+		ocs = append(ocs, &oc)
+	}
+	printed := &Printed{Conflicts: append(prev.Conflicts, files.assign()...)}
+
+	if err := fsys.MkdirAll(".", 0755); err != nil {
+		return nil, err
+	}
+	p := &printer{fsys: fsys, lua: f, files: files, taken: map[string]map[string]bool{}, written: map[string]bool{}}
+	names := []string{}
+	for _, oc := range ocs {
+		name, err := oc.printToFile(".", p)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		names = append(names, name)
+	}
+	if err := p.removeStale(prev); err != nil {
+		return nil, err
+	}
+	if !sort.StringsAreSorted(names) {
+		printed.Order = names
+	}
+	for name := range files.written {
+		printed.TextFiles = append(printed.TextFiles, name)
+	}
+	sort.Strings(printed.TextFiles)
+	printed.Conflicts = append(printed.Conflicts, p.conflicts...)
+	return printed, nil
+}
+
+// ParseObject reads the object file filepath of the objects folder fsys, and
+// the objects it contains, as ParseAllObjectStates would.
+func ParseObject(fsys fs.FS, l file.LuaReader, filepath string, origins file.ScriptOrigins) (*ttsjson.Object, error) {
+	d := db{}
+	o, err := parseFile(fsys, filepath, nil, &d)
+	if err != nil {
+		return nil, err
+	}
+	if o.subObjDir != "" {
+		sub := path.Join(path.Dir(filepath), o.subObjDir)
+		if fi, err := fs.Stat(fsys, sub); err == nil && fi.IsDir() {
+			if err := parseFolder(fsys, sub, o, o.subObjOrder, &d); err != nil {
+				return nil, err
+			}
+		}
+	}
+	printed, err := o.print(l, origins)
+	if err != nil {
+		return nil, fmt.Errorf("obj (%s) did not print : %v", o.guid, err)
+	}
+	return printed, nil
+}
+
+// AddObjectStates prints objs into the folder dir of the objects folder fsys,
+// beside the objects already there, which are left alone. Files are named as
+// PrintObjectStates names them, but never after a file or folder already in
+// dir, or one of textFiles under the text directory. The Order it returns
+// always lists the files written into dir.
+func AddObjectStates(fsys file.WriteFS, f file.LuaWriter, dir string, objs []*ttsjson.Object, pol *policy.Policy, naming Naming, textFiles []string) (*Printed, error) {
+	ocs := []*objConfig{}
+	files := newSharedFiles(pol, naming)
+	for _, t := range textFiles {
+		files.taken[strings.ToLower(t)] = true
+	}
+	for _, rootObj := range objs {
+		oc := objConfig{}
+		if err := oc.parseFromJSON(rootObj); err != nil {
+			return nil, err
+		}
+		files.collect(&oc)
+		ocs = append(ocs, &oc)
+	}
+	printed := &Printed{Conflicts: files.assign()}
+
+	if err := fsys.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	existing, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	p := &printer{fsys: fsys, lua: f, files: files, taken: map[string]map[string]bool{dir: {}}, written: map[string]bool{}}
+	for _, e := range existing {
+		p.taken[dir][strings.ToLower(e.Name())] = true
+	}
+	for _, oc := range ocs {
+		name, err := oc.printToFile(dir, p)
+		if err != nil {
+			return nil, err
+		}
+		printed.Order = append(printed.Order, name)
+	}
+	for name := range files.written {
+		printed.TextFiles = append(printed.TextFiles, name)
+	}
+	sort.Strings(printed.TextFiles)
+	printed.Conflicts = append(printed.Conflicts, p.conflicts...)
+	return printed, nil
+}
+
+// Walk calls fn on every object in objs, which may be an ObjectStates array
+// from a decoded mod or from ParseAllObjectStates. Objects inside States,
+// ContainedObjects and ChildObjects (those attached to it) are visited after
+// their parent.
+func Walk(objs interface{}, fn func(o *ttsjson.Object)) {
+	arr, _ := objs.([]interface{})
+	for _, raw := range arr {
+		if o, ok := raw.(*ttsjson.Object); ok {
+			walkObj(o, fn)
+		}
+	}
+}
+
+func walkObj(o *ttsjson.Object, fn func(o *ttsjson.Object)) {
+	fn(o)
+	if states, ok := o.Object("States"); ok {
+		keys := states.Keys()
+		sort.Strings(keys)
+		for _, k := range keys {
+			if state, ok := states.Object(k); ok {
+				walkObj(state, fn)
+			}
+		}
+	}
+	for _, k := range []string{"ContainedObjects", "ChildObjects"} {
+		subs, _ := o.Get(k)
+		Walk(subs, fn)
 	}
-	return nil
 }
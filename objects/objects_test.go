@@ -0,0 +1,107 @@
+package objects
+
+import (
+	"ModCreator/file"
+	"ModCreator/policy"
+	"ModCreator/ttsjson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSharedScripts(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	objs := filepath.Join(root, "objects")
+	for _, d := range []string{src, objs} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shared := "function onLoad() print('a token script long enough to be written to its own file') end"
+	other := "function onLoad() print('another script which is long enough to get its own file') end"
+	ui := "<Panel><Text>a user interface long enough to be written to its own file</Text></Panel>"
+	mk := func(guid, nick, script string) *ttsjson.Object {
+		o := ttsjson.NewObject()
+		o.Set("GUID", guid)
+		o.Set("Name", "Custom_Token")
+		o.Set("Nickname", nick)
+		o.Set("LuaScript", script)
+		o.Set("XmlUI", ui)
+		return o
+	}
+	in := []*ttsjson.Object{
+		mk("aaa111", "Clue", shared),
+		mk("bbb222", "Clue", shared),
+		mk("ccc333", "Doom", other),
+		mk("ddd444", "Doom", shared),
+	}
+	want := []string{}
+	for _, o := range in {
+		b, err := ttsjson.Marshal(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, string(b))
+	}
+
+	l := file.NewLuaOps(src)
+	prev, err := ReadPrevious(file.DirFS(objs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PrintObjectStates(file.DirFS(objs), l, in, policy.Default(nil, nil, nil), DefaultNaming, prev); err != nil {
+		t.Fatalf("PrintObjectStates() : %v", err)
+	}
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	wantNames := "Custom_Token.ccc333.ttslua,shared.56feec4f.xml,shared.60928b6f.ttslua"
+	if strings.Join(names, ",") != wantNames {
+		t.Errorf("want files %s got %s", wantNames, strings.Join(names, ","))
+	}
+
+	origins := file.ScriptOrigins{}
+	got, err := ParseAllObjectStates(file.DirFS(objs), l, nil, origins)
+	if err != nil {
+		t.Fatalf("ParseAllObjectStates() : %v", err)
+	}
+	wantFiles := []string{"shared.60928b6f.ttslua", "shared.60928b6f.ttslua", "Custom_Token.ccc333.ttslua", "shared.60928b6f.ttslua"}
+	for i, o := range got {
+		b, err := ttsjson.Marshal(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want[i] {
+			t.Errorf("object %v : want <%s> got <%s>", i, want[i], b)
+		}
+		if lines := origins.Origins(o.(*ttsjson.Object)); len(lines) == 0 || lines[0].File != wantFiles[i] {
+			t.Errorf("object %v : want its script from %s got %v", i, wantFiles[i], lines)
+		}
+	}
+}
+
+func TestSharedNickname(t *testing.T) {
+	s := newSharedFiles(policy.Default(nil, nil, nil), DefaultNaming)
+	script := strings.Repeat("x", 100)
+	for _, guid := range []string{"aaa111", "bbb222"} {
+		o := ttsjson.NewObject()
+		o.Set("GUID", guid)
+		o.Set("Nickname", "Clue Token")
+		o.Set("LuaScript", script)
+		s.collect(&objConfig{guid: guid, data: o})
+	}
+	s.assign()
+	if got := s.fileFor("LuaScript", script); got != "ClueToken.shared.ttslua" {
+		t.Errorf("want ClueToken.shared.ttslua got %s", got)
+	}
+}
@@ -0,0 +1,236 @@
+package objects
+
+import (
+	"ModCreator/file"
+	"ModCreator/ttsjson"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Conflict is something reversing over an existing tree could not keep the way
+// it was.
+type Conflict struct {
+	// File is the file affected, relative to the objects or text directory.
+	File    string
+	Message string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s: %s", c.File, c.Message)
+}
+
+// Previous indexes the object files already in an objects directory, so that
+// reversing over it keeps the file names and folders chosen for each object.
+type Previous struct {
+	// byDir indexes objects by folder, then GUID; byGUID lists every object
+	// with a GUID, wherever it is.
+	byDir  map[string]map[string]*prevObject
+	byGUID map[string][]*prevObject
+	// files holds every object file, relative to the objects directory.
+	files []string
+	// Conflicts found while reading the directory.
+	Conflicts []Conflict
+}
+
+type prevObject struct {
+	// dir and file locate the object, relative to the objects directory.
+	dir    string
+	file   string
+	subDir string
+	// paths holds the file each text field was written to.
+	paths map[string]string
+	used  bool
+}
+
+// ReadPrevious indexes the objects directory fsys. A missing directory is an
+// empty index.
+func ReadPrevious(fsys fs.FS) (*Previous, error) {
+	p := &Previous{byDir: map[string]map[string]*prevObject{}, byGUID: map[string][]*prevObject{}}
+	err := fs.WalkDir(fsys, ".", func(rel string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+		p.files = append(p.files, rel)
+		b, err := fs.ReadFile(fsys, rel)
+		if err != nil {
+			return err
+		}
+		o, err := ttsjson.UnmarshalObject(b)
+		if err != nil {
+			p.Conflicts = append(p.Conflicts, Conflict{File: rel, Message: fmt.Sprintf("not an object, so it is replaced : %v", err)})
+			return nil
+		}
+		guid, _ := o.String("GUID")
+		dir := path.Dir(rel)
+		if other, ok := p.byDir[dir][guid]; ok {
+			p.Conflicts = append(p.Conflicts, Conflict{File: rel, Message: fmt.Sprintf("has the same GUID %s as %s, whose names are kept instead", guid, path.Join(other.dir, other.file))})
+			return nil
+		}
+		prev := &prevObject{dir: dir, file: path.Base(rel), paths: map[string]string{}}
+		for _, k := range o.Keys() {
+			v, ok := o.String(k)
+			if !ok || !strings.HasSuffix(k, pathExt) {
+				continue
+			}
+			if k == "ContainedObjects"+pathExt {
+				prev.subDir = v
+			} else {
+				prev.paths[strings.TrimSuffix(k, pathExt)] = v
+			}
+		}
+		if p.byDir[dir] == nil {
+			p.byDir[dir] = map[string]*prevObject{}
+		}
+		p.byDir[dir][guid] = prev
+		p.byGUID[guid] = append(p.byGUID[guid], prev)
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, nil
+	}
+	return p, err
+}
+
+// TextFiles lists the files under the text directory the objects refer to.
+func (p *Previous) TextFiles() []string {
+	files := []string{}
+	seen := map[string]bool{}
+	for _, prevs := range p.byGUID {
+		for _, prev := range prevs {
+			for _, f := range prev.paths {
+				if !seen[f] {
+					seen[f] = true
+					files = append(files, f)
+				}
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Find lists the object files with the GUID guid, relative to the objects
+// directory.
+func (p *Previous) Find(guid string) []string {
+	files := []string{}
+	for _, prev := range p.byGUID[guid] {
+		files = append(files, path.Join(prev.dir, prev.file))
+	}
+	sort.Strings(files)
+	return files
+}
+
+// match pairs o, found in the folder dir, and the objects it contains with
+// their previous files. Objects are looked for in the same folder first, since
+// containers often hold copies sharing a GUID, then anywhere when only one
+// object had the GUID, so moved objects keep their names too.
+func (p *Previous) match(o *objConfig, dir string) {
+	prev, ok := p.byDir[dir][o.guid]
+	if !ok || prev.used {
+		prev = nil
+		if all := p.byGUID[o.guid]; len(all) == 1 && !all[0].used {
+			prev = all[0]
+		}
+	}
+	subDir := ""
+	if prev != nil {
+		prev.used = true
+		o.prev = prev
+		if prev.subDir != "" {
+			subDir = path.Join(prev.dir, prev.subDir)
+		}
+	}
+	for _, sub := range o.subObj {
+		p.match(sub, subDir)
+	}
+}
+
+// Printed describes what PrintObjectStates wrote.
+type Printed struct {
+	// Order lists the files written to the objects directory in the order of
+	// the objects, or is nil when sorting them by name is enough.
+	Order []string
+	// TextFiles lists the files under the text directory the objects refer
+	// to.
+	TextFiles []string
+	Conflicts []Conflict
+}
+
+// printer holds the state of writing one objects directory.
+type printer struct {
+	fsys  file.WriteFS
+	lua   file.LuaWriter
+	files *sharedFiles
+	// taken holds the names used in each directory, lower cased, since
+	// names may not differ by case alone on every file system.
+	taken map[string]map[string]bool
+	// written holds every file and folder written, relative to root.
+	written   map[string]bool
+	conflicts []Conflict
+}
+
+// claim reserves a name in dir, preferring want. Should want be empty or
+// taken, the first of fallback, fallback_1, fallback_2... (each followed by
+// ext) which isn't is used instead. A want which couldn't be kept is reported
+// as a conflict.
+func (p *printer) claim(dir, want, fallback, ext string) string {
+	names, ok := p.taken[dir]
+	if !ok {
+		names = map[string]bool{}
+		p.taken[dir] = names
+	}
+	name := want
+	if name == "" || names[strings.ToLower(name)] {
+		name = fallback + ext
+		for n := 1; names[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s_%v%s", fallback, n, ext)
+		}
+		if want != "" {
+			p.conflicts = append(p.conflicts, Conflict{File: path.Join(dir, want), Message: fmt.Sprintf("already used by another object, so %s is written instead", path.Join(dir, name))})
+		}
+	}
+	names[strings.ToLower(name)] = true
+	p.written[path.Join(dir, name)] = true
+	return name
+}
+
+// write writes b to the file rel, unless it already holds b.
+func (p *printer) write(rel string, b []byte) error {
+	return file.WriteIfChanged(p.fsys, rel, b)
+}
+
+// removeStale deletes the object files of prev which weren't written again,
+// then any folder left empty.
+func (p *printer) removeStale(prev *Previous) error {
+	dirs := map[string]bool{}
+	for _, f := range prev.files {
+		if p.written[f] {
+			continue
+		}
+		if err := file.Remove(p.fsys, f); err != nil {
+			return err
+		}
+		for d := path.Dir(f); d != "."; d = path.Dir(d) {
+			dirs[d] = true
+		}
+	}
+	sorted := []string{}
+	for d := range dirs {
+		sorted = append(sorted, d)
+	}
+	// deepest first, so parents are empty by the time they're reached.
+	sort.Slice(sorted, func(i, k int) bool { return len(sorted[i]) > len(sorted[k]) })
+	for _, d := range sorted {
+		if entries, err := fs.ReadDir(p.fsys, d); err == nil && len(entries) == 0 {
+			p.fsys.Remove(d)
+		}
+	}
+	return nil
+}
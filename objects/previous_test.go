@@ -0,0 +1,118 @@
+package objects
+
+import (
+	"ModCreator/file"
+	"ModCreator/policy"
+	"ModCreator/ttsjson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrintOverPrevious(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	objs := filepath.Join(root, "objects")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := func(s string) string {
+		return "function onLoad() print('" + s + " is a script long enough to get a file of its own') end"
+	}
+	mk := func(guid, name, lua string, contained ...*ttsjson.Object) *ttsjson.Object {
+		o := ttsjson.NewObject()
+		o.Set("GUID", guid)
+		o.Set("Name", name)
+		o.Set("LuaScript", lua)
+		if len(contained) > 0 {
+			co := []interface{}{}
+			for _, c := range contained {
+				co = append(co, c)
+			}
+			o.Set("ContainedObjects", co)
+		}
+		return o
+	}
+	l := file.NewLuaOps(src)
+	print := func(in ...*ttsjson.Object) *Printed {
+		prev, err := ReadPrevious(file.DirFS(objs))
+		if err != nil {
+			t.Fatalf("ReadPrevious() : %v", err)
+		}
+		p, err := PrintObjectStates(file.DirFS(objs), l, in, policy.Default(nil, nil, nil), DefaultNaming, prev)
+		if err != nil {
+			t.Fatalf("PrintObjectStates() : %v", err)
+		}
+		return p
+	}
+	print(
+		mk("aaa111", "Bag", script("bag"), mk("bbb222", "Card", script("b")), mk("ccc333", "Card", script("c"))),
+		mk("ddd444", "Deck", script("deck")),
+	)
+
+	// the user renames the bag's file and folder.
+	bag, err := ioutil.ReadFile(filepath.Join(objs, "Bag.aaa111.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag = []byte(strings.Replace(string(bag), `"ContainedObjects_path": "aaa111"`, `"ContainedObjects_path": "board"`, 1))
+	if err := ioutil.WriteFile(filepath.Join(objs, "MyBag.json"), bag, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(objs, "Bag.aaa111.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(objs, "aaa111"), filepath.Join(objs, "board")); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	unchanged := filepath.Join(objs, "board", "Card.bbb222.json")
+	if err := os.Chtimes(unchanged, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// the card ccc333 changes and the deck is gone.
+	p := print(mk("aaa111", "Bag", script("bag"), mk("bbb222", "Card", script("b")), mk("ccc333", "Card", script("c2"))))
+	if len(p.Conflicts) != 0 {
+		t.Errorf("want no conflicts, got %v", p.Conflicts)
+	}
+	for _, f := range []string{"MyBag.json", "board/Card.bbb222.json", "board/Card.ccc333.json"} {
+		if _, err := os.Stat(filepath.Join(objs, f)); err != nil {
+			t.Errorf("want %s kept : %v", f, err)
+		}
+	}
+	for _, f := range []string{"Deck.ddd444.json", "aaa111", "aaa111_1"} {
+		if _, err := os.Stat(filepath.Join(objs, f)); !os.IsNotExist(err) {
+			t.Errorf("want %s gone, got %v", f, err)
+		}
+	}
+	if fi, err := os.Stat(unchanged); err != nil || !fi.ModTime().Equal(old) {
+		t.Errorf("want %s left alone", unchanged)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(src, "Card.ccc333.ttslua"))
+	if err != nil || string(b) != script("c2") {
+		t.Errorf("want the changed script written, got %s %v", b, err)
+	}
+	if strings.Join(p.TextFiles, ",") != "Bag.aaa111.ttslua,Card.bbb222.ttslua,Card.ccc333.ttslua" {
+		t.Errorf("unexpected text files %v", p.TextFiles)
+	}
+}
+
+func TestPrintOverPreviousConflict(t *testing.T) {
+	objs := t.TempDir()
+	for _, f := range []string{"A.json", "B.json"} {
+		if err := ioutil.WriteFile(filepath.Join(objs, f), []byte(`{"GUID": "abc123", "Name": "Card"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev, err := ReadPrevious(file.DirFS(objs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prev.Conflicts) != 1 || prev.Conflicts[0].File != "B.json" {
+		t.Errorf("want B.json reported as a duplicate GUID, got %v", prev.Conflicts)
+	}
+}
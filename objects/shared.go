@@ -0,0 +1,204 @@
+package objects
+
+import (
+	"ModCreator/file"
+	"ModCreator/policy"
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// extensions are those of the files a text field of an object is written to.
+// Any other field gets a .<key>.txt file.
+var extensions = map[string]string{
+	"LuaScript":      ".ttslua",
+	"LuaScriptState": ".txt",
+	"XmlUI":          ".xml",
+}
+
+type field struct {
+	key string
+	ext string
+}
+
+func fieldFor(key string) field {
+	if ext, ok := extensions[key]; ok {
+		return field{key: key, ext: ext}
+	}
+	return field{key: key, ext: "." + key + ".txt"}
+}
+
+// file returns what to write for value, and the extension of its file. Script
+// state holding json is written indented, as a .state.json file.
+func (f field) file(value string) (string, string) {
+	if f.key == "LuaScriptState" {
+		if pretty, ok := file.PrettyState(value); ok {
+			return pretty, file.StateExt
+		}
+	}
+	return value, f.ext
+}
+
+var unsafeName = regexp.MustCompile("[^a-zA-Z0-9_-]+")
+
+// sharedFiles picks the file each externalized value is written to. A value
+// used by a single object gets a file named after the object, as naming says. Identical values
+// used by several objects share one file, named after their common Nickname
+// (like Clue.shared.ttslua), or failing that after the value's hash, so a fix
+// only has to be made once.
+type sharedFiles struct {
+	// policy decides which fields are written to files at all.
+	policy *policy.Policy
+	naming Naming
+	groups map[string]*valueGroup
+	order  []*valueGroup
+	// taken holds the names given, lower cased, since names may not differ
+	// by case alone on every file system.
+	taken map[string]bool
+	// written holds the files already written, since shared files are
+	// reached once per object using them.
+	written map[string]bool
+}
+
+type valueGroup struct {
+	key   string
+	ext   string
+	value string
+	users []*objConfig
+	name  string
+}
+
+func newSharedFiles(pol *policy.Policy, naming Naming) *sharedFiles {
+	return &sharedFiles{policy: pol, naming: naming, groups: map[string]*valueGroup{}, taken: map[string]bool{}, written: map[string]bool{}}
+}
+
+// fields lists the text fields of o which are written to files: those the
+// policy extracts, and those which had a file before.
+func (s *sharedFiles) fields(o *objConfig) []field {
+	fields := []field{}
+	for _, k := range o.data.Keys() {
+		if v, ok := o.data.String(k); ok && (s.policy.ExtractObject(k, v) || o.prev != nil && o.prev.paths[k] != "") {
+			fields = append(fields, fieldFor(k))
+		}
+	}
+	return fields
+}
+
+// collect records the values o, and the objects it contains, will externalize.
+func (s *sharedFiles) collect(o *objConfig) {
+	for _, e := range s.fields(o) {
+		v, _ := o.data.String(e.key)
+		k := e.key + "\x00" + v
+		g, ok := s.groups[k]
+		if !ok {
+			_, ext := e.file(v)
+			g = &valueGroup{key: e.key, ext: ext, value: v}
+			s.groups[k] = g
+			s.order = append(s.order, g)
+		}
+		g.users = append(g.users, o)
+	}
+	for _, sub := range o.subObj {
+		s.collect(sub)
+	}
+}
+
+// assign names the files, in the order their values were first seen, so the
+// same objects always get the same names. Values keep the file their objects
+// used before where they can, ahead of any new name; it returns the files
+// which couldn't be kept.
+func (s *sharedFiles) assign() []Conflict {
+	conflicts := []Conflict{}
+	for _, g := range s.order {
+		if prev := previousFile(g); prev != "" {
+			if !s.taken[strings.ToLower(prev)] && path.Ext(prev) == path.Ext(g.ext) {
+				g.name = prev
+				s.taken[strings.ToLower(g.name)] = true
+				continue
+			}
+			if s.taken[strings.ToLower(prev)] {
+				conflicts = append(conflicts, Conflict{File: prev, Message: fmt.Sprintf("objects %s shared it, but their %s is no longer the same", strings.Join(previousUsers(s.order, g.key, prev), ", "), g.key)})
+			}
+		}
+	}
+	for _, g := range s.order {
+		if g.name != "" {
+			continue
+		}
+		if len(g.users) < 2 {
+			g.name = s.claim(s.naming.base(g.users[0]), g.ext)
+			continue
+		}
+		sum := fmt.Sprintf("%x", sha256.Sum256([]byte(g.value)))[:8]
+		base := "shared." + sum
+		if nick := commonNickname(g.users); nick != "" {
+			// the infix keeps clear of the files named after one object, or
+			// after a key of the save.
+			base = nick + ".shared"
+			if s.taken[strings.ToLower(base+g.ext)] {
+				base = nick + "." + sum
+			}
+		}
+		g.name = s.claim(base, g.ext)
+	}
+	return conflicts
+}
+
+// claim reserves the first of base, base_1, base_2... (each followed by ext)
+// which isn't taken.
+func (s *sharedFiles) claim(base, ext string) string {
+	name := base + ext
+	for n := 1; s.taken[strings.ToLower(name)]; n++ {
+		name = fmt.Sprintf("%s_%v%s", base, n, ext)
+	}
+	s.taken[strings.ToLower(name)] = true
+	return name
+}
+
+// previousFile is the file every user of g wrote its value to before, if
+// they agree on one.
+func previousFile(g *valueGroup) string {
+	name := ""
+	for _, u := range g.users {
+		if u.prev == nil {
+			continue
+		}
+		p := u.prev.paths[g.key]
+		if p == "" || (name != "" && p != name) {
+			return ""
+		}
+		name = p
+	}
+	return name
+}
+
+// previousUsers lists the GUIDs of the objects which wrote their key to file
+// before.
+func previousUsers(groups []*valueGroup, key, file string) []string {
+	guids := []string{}
+	for _, g := range groups {
+		for _, u := range g.users {
+			if g.key == key && u.prev != nil && u.prev.paths[key] == file {
+				guids = append(guids, u.guid)
+			}
+		}
+	}
+	return guids
+}
+
+// fileFor returns the file the value of key is written to.
+func (s *sharedFiles) fileFor(key, value string) string {
+	return s.groups[key+"\x00"+value].name
+}
+
+func commonNickname(users []*objConfig) string {
+	nick, _ := users[0].data.String("Nickname")
+	for _, u := range users[1:] {
+		if n, _ := u.data.String("Nickname"); n != nick {
+			return ""
+		}
+	}
+	return cleanName(nick)
+}
@@ -0,0 +1,161 @@
+// Package policy decides which values reverse moves out of config.json and the
+// object files into files of their own.
+package policy
+
+import (
+	"ModCreator/ttsjson"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+const (
+	// Always and Never may be given in a policy file instead of a size.
+	Always = "always"
+	Never  = "never"
+
+	never = -1
+)
+
+// reserved object keys identify an object, so they stay in its file.
+var reserved = map[string]bool{"GUID": true, "Name": true}
+
+// Rule decides for every key matching Pattern, a path.Match pattern.
+type Rule struct {
+	Pattern string
+	// MinSize is the smallest size of value extracted: 0 to always extract,
+	// and -1 to never extract.
+	MinSize int
+}
+
+func (r Rule) extract(v interface{}) bool {
+	return r.MinSize != never && Size(v) >= r.MinSize
+}
+
+// Policy lists the rules for keys of the save, and for keys of each object.
+// The first rule matching a key decides; keys no rule matches are never
+// extracted.
+type Policy struct {
+	Save    []Rule
+	Objects []Rule
+}
+
+// Default is the policy reverse uses without a policy file: save strings in
+// strKeys of 80 characters or more, objects in objKeys of 100 or more and
+// arrays in arrKeys of 200 or more. Of each object, the LuaScript,
+// LuaScriptState and XmlUI are extracted when longer than 80 characters.
+func Default(strKeys, objKeys, arrKeys []string) *Policy {
+	p := &Policy{}
+	for _, keys := range []struct {
+		keys []string
+		min  int
+	}{{strKeys, 80}, {objKeys, 100}, {arrKeys, 200}} {
+		for _, k := range keys.keys {
+			p.Save = append(p.Save, Rule{Pattern: k, MinSize: keys.min})
+		}
+	}
+	for _, k := range []string{"LuaScript", "LuaScriptState", "XmlUI"} {
+		p.Objects = append(p.Objects, Rule{Pattern: k, MinSize: 81})
+	}
+	return p
+}
+
+// Read reads the policy file from fsys. Its rules come ahead of those of def,
+// so they decide for any key they match. The file looks like:
+//
+//	{
+//	  "save": {"Note": "never", "Custom*": 500},
+//	  "objects": {"XmlUI": "always", "Description": 200}
+//	}
+//
+// where a number extracts values longer than it. Rules are tried in the order
+// they are written.
+func Read(fsys fs.FS, file string, def *Policy) (*Policy, error) {
+	b, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+	o, err := ttsjson.UnmarshalObject(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %v", file, err)
+	}
+	p := &Policy{}
+	for _, section := range []struct {
+		key   string
+		rules *[]Rule
+		def   []Rule
+	}{{"save", &p.Save, def.Save}, {"objects", &p.Objects, def.Objects}} {
+		raw, ok := o.Get(section.key)
+		if ok {
+			rules, ok := raw.(*ttsjson.Object)
+			if !ok {
+				return nil, fmt.Errorf("%s : expected %s to be an object of rules, got %v", file, section.key, raw)
+			}
+			for _, pattern := range rules.Keys() {
+				v, _ := rules.Get(pattern)
+				r, err := parseRule(pattern, v)
+				if err != nil {
+					return nil, fmt.Errorf("%s : %v", file, err)
+				}
+				*section.rules = append(*section.rules, r)
+			}
+		}
+		*section.rules = append(*section.rules, section.def...)
+	}
+	for _, k := range o.Keys() {
+		if k != "save" && k != "objects" {
+			return nil, fmt.Errorf("%s : unknown section %s", file, k)
+		}
+	}
+	return p, nil
+}
+
+func parseRule(pattern string, v interface{}) (Rule, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return Rule{}, fmt.Errorf("bad pattern %s : %v", pattern, err)
+	}
+	switch val := v.(type) {
+	case string:
+		switch val {
+		case Always:
+			return Rule{Pattern: pattern, MinSize: 0}, nil
+		case Never:
+			return Rule{Pattern: pattern, MinSize: never}, nil
+		}
+	case json.Number:
+		n, err := val.Int64()
+		if err == nil && n >= 0 {
+			return Rule{Pattern: pattern, MinSize: int(n) + 1}, nil
+		}
+	}
+	return Rule{}, fmt.Errorf("rule for %s must be %q, %q or a size, got %v", pattern, Always, Never, v)
+}
+
+// ExtractSave reports whether the value v of key in the save is extracted.
+func (p *Policy) ExtractSave(key string, v interface{}) bool {
+	return decide(p.Save, key, v)
+}
+
+// ExtractObject reports whether the value v of key in an object is extracted.
+func (p *Policy) ExtractObject(key string, v string) bool {
+	return !reserved[key] && decide(p.Objects, key, v)
+}
+
+func decide(rules []Rule, key string, v interface{}) bool {
+	for _, r := range rules {
+		if ok, _ := path.Match(r.Pattern, key); ok {
+			return r.extract(v)
+		}
+	}
+	return false
+}
+
+// Size measures a value: the length of a string, or the length of anything
+// else as printed by fmt.
+func Size(v interface{}) int {
+	if s, ok := v.(string); ok {
+		return len(s)
+	}
+	return len(fmt.Sprint(ttsjson.Plain(v)))
+}
@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"ModCreator/ttsjson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDefault(t *testing.T) {
+	p := Default([]string{"LuaScript"}, []string{"Grid"}, []string{"SnapPoints"})
+	obj := ttsjson.NewObject()
+	obj.Set("Type", strings.Repeat("x", 100))
+
+	cases := []struct {
+		key  string
+		v    interface{}
+		want bool
+	}{
+		{"LuaScript", strings.Repeat("x", 79), false},
+		{"LuaScript", strings.Repeat("x", 80), true},
+		{"Grid", ttsjson.NewObject(), false},
+		{"Grid", obj, true},
+		{"SnapPoints", []interface{}{obj}, false},
+		{"Note", strings.Repeat("x", 1000), false},
+	}
+	for _, c := range cases {
+		if got := p.ExtractSave(c.key, c.v); got != c.want {
+			t.Errorf("ExtractSave(%s, <%v long>) : want %v got %v", c.key, Size(c.v), c.want, got)
+		}
+	}
+	if p.ExtractObject("XmlUI", strings.Repeat("x", 80)) || !p.ExtractObject("XmlUI", strings.Repeat("x", 81)) {
+		t.Errorf("want object XmlUI extracted when longer than 80")
+	}
+	if p.ExtractObject("GMNotes", strings.Repeat("x", 1000)) {
+		t.Errorf("want GMNotes kept by default")
+	}
+}
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "extract.json"), []byte(`{
+  "save": {"Note": "never", "LuaScript": "always", "Custom*": 10},
+  "objects": {"GM*": 5, "Description": "always", "*": "always"}
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Read(os.DirFS(dir), "extract.json", Default([]string{"LuaScript", "Note", "XmlUI"}, nil, nil))
+	if err != nil {
+		t.Fatalf("Read() : %v", err)
+	}
+	save := []struct {
+		key  string
+		v    string
+		want bool
+	}{
+		{"Note", strings.Repeat("x", 1000), false},
+		{"LuaScript", "", true},
+		{"CustomUIAssets", strings.Repeat("x", 10), false},
+		{"CustomUIAssets", strings.Repeat("x", 11), true},
+		{"XmlUI", strings.Repeat("x", 80), true},
+		{"XmlUI", strings.Repeat("x", 79), false},
+	}
+	for _, c := range save {
+		if got := p.ExtractSave(c.key, c.v); got != c.want {
+			t.Errorf("ExtractSave(%s, <%v long>) : want %v got %v", c.key, len(c.v), c.want, got)
+		}
+	}
+	objects := []struct {
+		key  string
+		v    string
+		want bool
+	}{
+		{"GMNotes", "12345", false},
+		{"GMNotes", "123456", true},
+		{"Description", "", true},
+		{"Nickname", "", true},
+		{"GUID", "abc123", false},
+		{"Name", "Card", false},
+	}
+	for _, c := range objects {
+		if got := p.ExtractObject(c.key, c.v); got != c.want {
+			t.Errorf("ExtractObject(%s, %s) : want %v got %v", c.key, c.v, c.want, got)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, policy := range []string{
+		`{"save": {"Note": "sometimes"}}`,
+		`{"save": {"Note": -1}}`,
+		`{"save": {"[": "always"}}`,
+		`{"save": []}`,
+		`{"scripts": {}}`,
+	} {
+		fsys := fstest.MapFS{"extract.json": {Data: []byte(policy)}}
+		if _, err := Read(fsys, "extract.json", Default(nil, nil, nil)); err == nil {
+			t.Errorf("want an error for %s", policy)
+		}
+	}
+}
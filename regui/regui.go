@@ -0,0 +1,416 @@
+package regui
+
+import (
+	"ModCreator/file"
+	"ModCreator/objects"
+	"ModCreator/ttsjson"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	validGUID = regexp.MustCompile(`^[0-9a-fA-F]{6}$`)
+	// wordToken matches one identifier or number.
+	wordToken = regexp.MustCompile(`[0-9A-Za-z_]+`)
+
+	// referenceKeys are the string fields of an object which may mention
+	// other objects by GUID.
+	referenceKeys = []string{"LuaScript", "LuaScriptState", "XmlUI", "GMNotes"}
+)
+
+// Change describes a single GUID being replaced by another.
+type Change struct {
+	Old string
+	New string
+}
+
+// ParseChange reads a change written as "old=new".
+func ParseChange(s string) (Change, error) {
+	parts := strings.Split(s, "=")
+	if len(parts) != 2 {
+		return Change{}, fmt.Errorf("expected <old>=<new>, got %s", s)
+	}
+	c := Change{Old: parts[0], New: parts[1]}
+	for _, g := range []string{c.Old, c.New} {
+		if !validGUID.MatchString(g) {
+			return Change{}, fmt.Errorf("%s is not a six character hex GUID", g)
+		}
+	}
+	return c, nil
+}
+
+// Apply changes every GUID named in changes within the config directory
+// fsys. Object GUIDs, script references, and ContainedObjects directories are
+// all rewritten. Either every file is updated or none are.
+func Apply(fsys file.WriteFS, textSubdir, objectsSubdir string, changes []Change) error {
+	guids := map[string]string{}
+	targets := map[string]bool{}
+	for _, c := range changes {
+		if _, ok := guids[c.Old]; ok {
+			return fmt.Errorf("GUID %s is changed more than once", c.Old)
+		}
+		if targets[c.New] {
+			return fmt.Errorf("more than one GUID is changed to %s", c.New)
+		}
+		guids[c.Old] = c.New
+		targets[c.New] = true
+	}
+
+	p := &plan{
+		fsys:     fsys,
+		guids:    guids,
+		writes:   map[string][]byte{},
+		existing: map[string]bool{},
+		found:    map[string]bool{},
+	}
+	if err := p.planObjects(path.Clean(objectsSubdir), 0); err != nil {
+		return err
+	}
+	for _, c := range changes {
+		if !p.found[c.Old] {
+			return fmt.Errorf("no object with GUID %s", c.Old)
+		}
+		if p.existing[c.New] && guids[c.New] == "" {
+			return fmt.Errorf("GUID %s is already in use", c.New)
+		}
+	}
+	if err := p.checkRenames(); err != nil {
+		return err
+	}
+	if err := p.planConfig("config.json"); err != nil {
+		return err
+	}
+	if err := p.planText(path.Clean(textSubdir)); err != nil {
+		return err
+	}
+	return p.apply()
+}
+
+// Reassign gives the objects in objs (an ObjectStates or ContainedObjects
+// array) whose GUID is in taken a new GUID nothing uses, and updates the
+// references to it in their scripts, XmlUI, LuaScriptState and GMNotes.
+// Objects sharing a GUID get the same new one. It returns the changes made, in
+// the order the objects appear.
+func Reassign(objs []interface{}, taken map[string]bool) []Change {
+	used := map[string]bool{}
+	for g := range taken {
+		used[g] = true
+	}
+	order := []string{}
+	inObjs := map[string]bool{}
+	objects.Walk(objs, func(o *ttsjson.Object) {
+		if g, ok := o.String("GUID"); ok && !inObjs[g] {
+			inObjs[g] = true
+			used[g] = true
+			order = append(order, g)
+		}
+	})
+	p := &plan{guids: map[string]string{}, existing: map[string]bool{}, found: map[string]bool{}}
+	changes := []Change{}
+	for _, g := range order {
+		if !taken[g] {
+			continue
+		}
+		n := nextFree(g, used)
+		used[n] = true
+		p.guids[g] = n
+		changes = append(changes, Change{Old: g, New: n})
+	}
+	for _, raw := range objs {
+		if o, ok := raw.(*ttsjson.Object); ok {
+			p.rewriteObj(o)
+		}
+	}
+	return changes
+}
+
+// nextFree is the first GUID counting up from g which isn't used.
+func nextFree(g string, used map[string]bool) string {
+	n, err := strconv.ParseUint(g, 16, 32)
+	if err != nil {
+		n = 0
+	}
+	for {
+		n = (n + 1) & 0xffffff
+		if c := fmt.Sprintf("%06x", n); !used[c] {
+			return c
+		}
+	}
+}
+
+type rename struct {
+	from, to string
+	depth    int
+}
+
+type plan struct {
+	fsys     file.WriteFS
+	guids    map[string]string
+	writes   map[string][]byte
+	renames  []rename
+	existing map[string]bool
+	found    map[string]bool
+}
+
+func (p *plan) planObjects(dir string, depth int) error {
+	files, err := fs.ReadDir(p.fsys, dir)
+	if err != nil {
+		return fmt.Errorf("fs.ReadDir(%s) : %v", dir, err)
+	}
+	for _, f := range files {
+		fp := path.Join(dir, f.Name())
+		if f.IsDir() {
+			if err := p.planObjects(fp, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		b, err := fs.ReadFile(p.fsys, fp)
+		if err != nil {
+			return fmt.Errorf("fs.ReadFile(%s) : %v", fp, err)
+		}
+		o, err := ttsjson.UnmarshalObject(b)
+		if err != nil {
+			return fmt.Errorf("ttsjson.UnmarshalObject(%s) : %v", fp, err)
+		}
+		changed := p.rewriteObj(o)
+		if subDir, ok := o.String("ContainedObjects_path"); ok {
+			if renamed, ok := p.renameDir(subDir); ok {
+				p.renames = append(p.renames, rename{from: path.Join(dir, subDir), to: path.Join(dir, renamed), depth: depth})
+				o.Set("ContainedObjects_path", renamed)
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		b, err = ttsjson.Marshal(o)
+		if err != nil {
+			return fmt.Errorf("ttsjson.Marshal(%s) : %v", fp, err)
+		}
+		p.writes[fp] = b
+	}
+	return nil
+}
+
+// checkRenames makes sure no directory is renamed onto one which exists and
+// which no other rename moves away.
+func (p *plan) checkRenames() error {
+	freed := map[string]bool{}
+	for _, r := range p.renames {
+		freed[r.from] = true
+	}
+	for _, r := range p.renames {
+		if _, err := fs.Stat(p.fsys, r.to); err == nil && !freed[r.to] {
+			return fmt.Errorf("cannot rename %s, %s already exists", r.from, r.to)
+		}
+	}
+	return nil
+}
+
+// rewriteObj updates a single object (and any of its inline states, contained
+// or attached objects). It reports whether anything was modified.
+func (p *plan) rewriteObj(o *ttsjson.Object) bool {
+	changed := false
+	if g, ok := o.String("GUID"); ok {
+		p.existing[g] = true
+		if n, ok := p.guids[g]; ok {
+			p.found[g] = true
+			o.Set("GUID", n)
+			changed = true
+		}
+	}
+	for _, k := range referenceKeys {
+		s, ok := o.String(k)
+		if !ok {
+			continue
+		}
+		if replaced, n := p.replaceAll(s); n > 0 {
+			o.Set(k, replaced)
+			changed = true
+		}
+	}
+	if states, ok := o.Object("States"); ok {
+		for _, k := range states.Keys() {
+			if state, ok := states.Object(k); ok {
+				changed = p.rewriteObj(state) || changed
+			}
+		}
+	}
+	for _, k := range []string{"ContainedObjects", "ChildObjects"} {
+		subs, _ := o.Array(k)
+		for _, rawSub := range subs {
+			if sub, ok := rawSub.(*ttsjson.Object); ok {
+				changed = p.rewriteObj(sub) || changed
+			}
+		}
+	}
+	return changed
+}
+
+// renameDir maps a ContainedObjects directory name such as "abc123" or
+// "abc123_1" onto the new GUID.
+func (p *plan) renameDir(name string) (string, bool) {
+	base, suffix := name, ""
+	if i := strings.Index(name, "_"); i >= 0 {
+		base, suffix = name[:i], name[i:]
+	}
+	n, ok := p.guids[base]
+	if !ok {
+		return "", false
+	}
+	return n + suffix, true
+}
+
+func (p *plan) planConfig(fp string) error {
+	b, err := fs.ReadFile(p.fsys, fp)
+	if err != nil {
+		return fmt.Errorf("fs.ReadFile(%s) : %v", fp, err)
+	}
+	c, err := ttsjson.UnmarshalObject(b)
+	if err != nil {
+		return fmt.Errorf("ttsjson.UnmarshalObject(%s) : %v", fp, err)
+	}
+	changed := false
+	for _, k := range append(referenceKeys, "Note") {
+		s, ok := c.String(k)
+		if !ok {
+			continue
+		}
+		if replaced, n := p.replaceAll(s); n > 0 {
+			c.Set(k, replaced)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	b, err = ttsjson.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("ttsjson.Marshal(%s) : %v", fp, err)
+	}
+	p.writes[fp] = b
+	return nil
+}
+
+func (p *plan) planText(dir string) error {
+	files, err := fs.ReadDir(p.fsys, dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fs.ReadDir(%s) : %v", dir, err)
+	}
+	for _, f := range files {
+		fp := path.Join(dir, f.Name())
+		if f.IsDir() {
+			if err := p.planText(fp); err != nil {
+				return err
+			}
+			continue
+		}
+		b, err := fs.ReadFile(p.fsys, fp)
+		if err != nil {
+			return fmt.Errorf("fs.ReadFile(%s) : %v", fp, err)
+		}
+		if replaced, n := p.replaceAll(string(b)); n > 0 {
+			p.writes[fp] = []byte(replaced)
+		}
+	}
+	return nil
+}
+
+// replaceAll swaps every standalone occurrence of a changed GUID in s. It
+// looks at each token once, so GUIDs may trade places.
+func (p *plan) replaceAll(s string) (string, int) {
+	total := 0
+	s = wordToken.ReplaceAllStringFunc(s, func(tok string) string {
+		if n, ok := p.guids[tok]; ok {
+			total++
+			return n
+		}
+		return tok
+	})
+	return s, total
+}
+
+func (p *plan) apply() error {
+	type undo func() error
+	var undos []undo
+	rollback := func(cause error) error {
+		for i := len(undos) - 1; i >= 0; i-- {
+			if err := undos[i](); err != nil {
+				return fmt.Errorf("%v; rollback also failed : %v", cause, err)
+			}
+		}
+		return cause
+	}
+
+	files := make([]string, 0, len(p.writes))
+	for fp := range p.writes {
+		files = append(files, fp)
+	}
+	sort.Strings(files)
+	for _, fp := range files {
+		orig, err := fs.ReadFile(p.fsys, fp)
+		if err != nil {
+			return rollback(fmt.Errorf("fs.ReadFile(%s) : %v", fp, err))
+		}
+		if err := writeAtomic(p.fsys, fp, p.writes[fp]); err != nil {
+			return rollback(err)
+		}
+		fp := fp
+		undos = append(undos, func() error { return writeAtomic(p.fsys, fp, orig) })
+	}
+
+	// rename the deepest directories first so parent paths stay valid. Each
+	// depth is moved aside to temporary names before taking its new ones, so
+	// directories may trade names.
+	sort.SliceStable(p.renames, func(i, k int) bool {
+		return p.renames[i].depth > p.renames[k].depth
+	})
+	move := func(from, to string) error {
+		if err := p.fsys.Rename(from, to); err != nil {
+			return fmt.Errorf("Rename(%s, %s) : %v", from, to, err)
+		}
+		undos = append(undos, func() error { return p.fsys.Rename(to, from) })
+		return nil
+	}
+	for start := 0; start < len(p.renames); {
+		end := start
+		for end < len(p.renames) && p.renames[end].depth == p.renames[start].depth {
+			end++
+		}
+		level := p.renames[start:end]
+		for _, r := range level {
+			if err := move(r.from, r.from+".regui"); err != nil {
+				return rollback(err)
+			}
+		}
+		for _, r := range level {
+			if err := move(r.from+".regui", r.to); err != nil {
+				return rollback(err)
+			}
+		}
+		start = end
+	}
+	return nil
+}
+
+func writeAtomic(fsys file.WriteFS, fp string, b []byte) error {
+	tmp := fp + ".regui"
+	if err := fsys.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("WriteFile(%s) : %v", tmp, err)
+	}
+	if err := fsys.Rename(tmp, fp); err != nil {
+		fsys.Remove(tmp)
+		return fmt.Errorf("Rename(%s, %s) : %v", tmp, fp, err)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package regui
+
+import (
+	"ModCreator/file"
+	"ModCreator/ttsjson"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		p := path.Join(root, name)
+		if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, p string) string {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestApply(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"config.json":               `{"LuaScript": "local b = getObjectFromGUID('abc123')"}`,
+		"src/lib.ttslua":            `BAG = "abc123"`,
+		"objects/Bag.abc123.json":   `{"GUID": "abc123", "ContainedObjects_path": "abc123"}`,
+		"objects/abc123/Card.json":  `{"GUID": "def456", "GMNotes": "lives in abc123"}`,
+		"objects/Other.f00f00.json": `{"GUID": "f00f00"}`,
+	})
+
+	err := Apply(file.DirFS(root), "src", "objects", []Change{{Old: "abc123", New: "123abc"}})
+	if err != nil {
+		t.Fatalf("Apply() : %v", err)
+	}
+
+	if got := readFile(t, path.Join(root, "src/lib.ttslua")); got != `BAG = "123abc"` {
+		t.Errorf("script not rewritten, got <%s>", got)
+	}
+	if got := readFile(t, path.Join(root, "config.json")); !strings.Contains(got, "getObjectFromGUID('123abc')") {
+		t.Errorf("global script not rewritten, got <%s>", got)
+	}
+	bag := readFile(t, path.Join(root, "objects/Bag.abc123.json"))
+	if !strings.Contains(bag, `"GUID": "123abc"`) || !strings.Contains(bag, `"ContainedObjects_path": "123abc"`) {
+		t.Errorf("bag not rewritten, got <%s>", bag)
+	}
+	if got := readFile(t, path.Join(root, "objects/123abc/Card.json")); !strings.Contains(got, "lives in 123abc") {
+		t.Errorf("contained object not rewritten, got <%s>", got)
+	}
+}
+
+func TestApplyMemFS(t *testing.T) {
+	m := file.NewMemFS()
+	for _, d := range []string{"objects/abc123", "objects/def456"} {
+		if err := m.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range map[string]string{
+		"config.json":              `{}`,
+		"objects/Bag.abc123.json":  `{"GUID": "abc123", "ContainedObjects_path": "abc123"}`,
+		"objects/abc123/Card.json": `{"GUID": "c0c001"}`,
+		"objects/Box.def456.json":  `{"GUID": "def456", "ContainedObjects_path": "def456"}`,
+		"objects/def456/Card.json": `{"GUID": "c0c002"}`,
+	} {
+		if err := m.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := Apply(m, "src", "objects", []Change{{Old: "abc123", New: "def456"}, {Old: "def456", New: "abc123"}})
+	if err != nil {
+		t.Fatalf("Apply() : %v", err)
+	}
+	if b, err := fs.ReadFile(m, "objects/def456/Card.json"); err != nil || !strings.Contains(string(b), "c0c001") {
+		t.Errorf("want the bag's card under def456, got <%s>, %v", b, err)
+	}
+	want := []string{"config.json", "objects/Bag.abc123.json", "objects/Box.def456.json", "objects/abc123/Card.json", "objects/def456/Card.json"}
+	if got := m.Files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want no temporary files left, %v got %v", want, got)
+	}
+}
+
+func TestApplyConflict(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"config.json":               `{}`,
+		"src/lib.ttslua":            `BAG = "abc123"`,
+		"objects/Bag.abc123.json":   `{"GUID": "abc123"}`,
+		"objects/Other.f00f00.json": `{"GUID": "f00f00"}`,
+	}
+	writeTree(t, root, files)
+
+	err := Apply(file.DirFS(root), "src", "objects", []Change{{Old: "abc123", New: "f00f00"}})
+	if err == nil {
+		t.Fatalf("expected error renaming onto an existing GUID")
+	}
+	for name, want := range files {
+		if got := readFile(t, path.Join(root, name)); got != want {
+			t.Errorf("%s modified: want <%s> got <%s>", name, want, got)
+		}
+	}
+}
+
+func TestApplySwap(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"config.json":              `{}`,
+		"src/lib.ttslua":           `A, B = "abc123", "def456"`,
+		"objects/Bag.abc123.json":  `{"GUID": "abc123", "LuaScript": "getObjectFromGUID('def456')"}`,
+		"objects/Card.def456.json": `{"GUID": "def456"}`,
+	})
+
+	err := Apply(file.DirFS(root), "src", "objects", []Change{{Old: "abc123", New: "def456"}, {Old: "def456", New: "abc123"}})
+	if err != nil {
+		t.Fatalf("Apply() : %v", err)
+	}
+	if got, want := readFile(t, path.Join(root, "src/lib.ttslua")), `A, B = "def456", "abc123"`; got != want {
+		t.Errorf("want <%s> got <%s>", want, got)
+	}
+	bag := readFile(t, path.Join(root, "objects/Bag.abc123.json"))
+	if !strings.Contains(bag, `"GUID": "def456"`) || !strings.Contains(bag, `getObjectFromGUID('abc123')`) {
+		t.Errorf("bag not swapped, got <%s>", bag)
+	}
+
+	// containers whose ContainedObjects folders are named after their GUID.
+	root = t.TempDir()
+	writeTree(t, root, map[string]string{
+		"config.json":                  `{}`,
+		"objects/Bag.abc123.json":      `{"GUID": "abc123", "ContainedObjects_path": "abc123"}`,
+		"objects/abc123/Card.json":     `{"GUID": "c0c001", "GMNotes": "in abc123"}`,
+		"objects/abc123/c0c001.json":   `{"GUID": "b0b001", "ContainedObjects_path": "b0b001"}`,
+		"objects/abc123/b0b001/A.json": `{"GUID": "a0a001"}`,
+		"objects/Box.def456.json":      `{"GUID": "def456", "ContainedObjects_path": "def456"}`,
+		"objects/def456/Card.json":     `{"GUID": "c0c002", "GMNotes": "in def456"}`,
+	})
+	err = Apply(file.DirFS(root), "src", "objects", []Change{{Old: "abc123", New: "def456"}, {Old: "def456", New: "abc123"}})
+	if err != nil {
+		t.Fatalf("Apply() : %v", err)
+	}
+	if got := readFile(t, path.Join(root, "objects/def456/Card.json")); !strings.Contains(got, "c0c001") || !strings.Contains(got, "in def456") {
+		t.Errorf("want the bag's card under def456, got <%s>", got)
+	}
+	if got := readFile(t, path.Join(root, "objects/abc123/Card.json")); !strings.Contains(got, "c0c002") || !strings.Contains(got, "in abc123") {
+		t.Errorf("want the box's card under abc123, got <%s>", got)
+	}
+	if got := readFile(t, path.Join(root, "objects/def456/b0b001/A.json")); !strings.Contains(got, "a0a001") {
+		t.Errorf("want nested folders moved along, got <%s>", got)
+	}
+	if bag := readFile(t, path.Join(root, "objects/Bag.abc123.json")); !strings.Contains(bag, `"ContainedObjects_path": "def456"`) {
+		t.Errorf("bag not swapped, got <%s>", bag)
+	}
+
+	err = Apply(file.DirFS(root), "src", "objects", []Change{{Old: "abc123", New: "fff000"}, {Old: "def456", New: "fff000"}})
+	if err == nil {
+		t.Errorf("expected an error changing two GUIDs to the same one")
+	}
+}
+
+func TestReassign(t *testing.T) {
+	save, err := ttsjson.UnmarshalObject([]byte(`{"ObjectStates": [
+  {"GUID": "abc123", "Name": "Bag", "LuaScript": "getObjectFromGUID('abc124') getObjectFromGUID('fff000')", "ContainedObjects": [
+    {"GUID": "abc124", "Name": "Card"},
+    {"GUID": "abc124", "Name": "Card"},
+    {"GUID": "fff000", "Name": "Card"}
+  ]}
+]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, _ := save.Array("ObjectStates")
+	changes := Reassign(objs, map[string]bool{"abc123": true, "abc124": true})
+	want := []Change{{Old: "abc123", New: "abc125"}, {Old: "abc124", New: "abc126"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("want %v got %v", want, changes)
+	}
+	b, _ := ttsjson.MarshalCompact(save)
+	wantJSON := `{"ObjectStates":[{"GUID":"abc125","Name":"Bag","LuaScript":"getObjectFromGUID('abc126') getObjectFromGUID('fff000')","ContainedObjects":[{"GUID":"abc126","Name":"Card"},{"GUID":"abc126","Name":"Card"},{"GUID":"fff000","Name":"Card"}]}]}`
+	if string(b) != wantJSON {
+		t.Errorf("want %s got %s", wantJSON, b)
+	}
+}
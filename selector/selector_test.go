@@ -0,0 +1,52 @@
+package selector
+
+import (
+	"ModCreator/ttsjson"
+	"reflect"
+	"testing"
+)
+
+func TestPick(t *testing.T) {
+	save, err := ttsjson.UnmarshalObject([]byte(`{"ObjectStates": [
+  {"GUID": "aaa111", "Name": "Custom_Model", "Nickname": "Dice Tower"},
+  {"GUID": "bbb222", "Name": "Bag", "Tags": ["Scoring"], "ContainedObjects": [
+    {"GUID": "ccc333", "Name": "Die_6", "Tags": ["Dice"]}
+  ]},
+  {"GUID": "ddd444", "Name": "Bag", "ContainedObjects": [
+    {"GUID": "eee555", "Name": "Die_6", "Tags": ["dice"]}
+  ]},
+  {"GUID": "fff666", "Name": "Card"}
+]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, _ := save.Array("ObjectStates")
+	for _, tc := range []struct {
+		args []string
+		want []string
+	}{
+		{args: []string{"name:dice tower"}, want: []string{"aaa111"}},
+		{args: []string{"fff666", "tag:Scoring"}, want: []string{"bbb222", "fff666"}},
+		// a die in a picked bag comes with the bag.
+		{args: []string{"tag:DICE", "bbb222"}, want: []string{"bbb222", "eee555"}},
+		{args: []string{"name:Card"}, want: []string{"fff666"}},
+		{args: []string{"type:Die_*"}, want: []string{"ccc333", "eee555"}},
+		{args: []string{"path:objects/Card.fff666.json"}, want: []string{}},
+	} {
+		s, err := Parse(tc.args)
+		if err != nil {
+			t.Fatalf("Parse(%v) : %v", tc.args, err)
+		}
+		got := []string{}
+		for _, o := range s.Pick(objs) {
+			g, _ := o.String("GUID")
+			got = append(got, g)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%v : want %v got %v", tc.args, tc.want, got)
+		}
+	}
+	if _, err := Parse([]string{"Dice Tower"}); err == nil {
+		t.Errorf("want an error for a bare name")
+	}
+}
@@ -0,0 +1,166 @@
+package sourcemap
+
+import (
+	"ModCreator/file"
+	"ModCreator/objects"
+	"ModCreator/ttsjson"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Global is the owner of the mod's global script.
+	Global = "Global"
+)
+
+var (
+	// like "Error in Script (Board - 1a2b3c): chunk_1:(812,4-20): ..."
+	// or "Error in Script (Global -1): chunk_1:(12,0-5): ..."
+	ttsError = regexp.MustCompile(`\((?:(?:.* - )?([0-9a-fA-F]{6})|(Global) -1)\):\s*chunk_\d+:\((\d+)`)
+)
+
+// Range maps the output lines Start through End onto consecutive lines of
+// File starting at Line.
+type Range struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+}
+
+// Map holds the ranges of every script in a mod, keyed by the GUID of the
+// object which owns the script, or Global. Objects may share a GUID, like the
+// cards of a deck, so each GUID has the ranges of every script of its
+// objects, in the order they appear in the mod.
+type Map map[string][][]Range
+
+// Location is a line of a file under the config directory.
+type Location struct {
+	File string
+	Line int
+}
+
+// Build maps every line of the built mod's scripts which came from a file.
+// Files are recorded relative to the config directory, under textSubdir.
+func Build(mod *ttsjson.Object, o file.Originer, textSubdir string) Map {
+	m := Map{}
+	add := func(owner string, obj *ttsjson.Object) {
+		if s, _ := obj.String("LuaScript"); s == "" {
+			return
+		}
+		if ranges := toRanges(o.Origins(obj), textSubdir); len(ranges) > 0 {
+			m[owner] = append(m[owner], ranges)
+		}
+	}
+	add(Global, mod)
+	objs, _ := mod.Get("ObjectStates")
+	objects.Walk(objs, func(obj *ttsjson.Object) {
+		if g, ok := obj.String("GUID"); ok {
+			add(g, obj)
+		}
+	})
+	return m
+}
+
+func toRanges(origins []file.Origin, textSubdir string) []Range {
+	ranges := []Range{}
+	for i, o := range origins {
+		if o.File == "" {
+			continue
+		}
+		f := path.Join(textSubdir, o.File)
+		if n := len(ranges); n > 0 {
+			last := &ranges[n-1]
+			if last.File == f && last.End == i && last.Line+(last.End-last.Start)+1 == o.Line {
+				last.End = i + 1
+				continue
+			}
+		}
+		ranges = append(ranges, Range{Start: i + 1, End: i + 1, File: f, Line: o.Line})
+	}
+	return ranges
+}
+
+// Locate finds the source file and line of a line in owner's built script.
+// Should several objects share owner's GUID, it finds the line of each of
+// their scripts, leaving out duplicates.
+func (m Map) Locate(owner string, line int) ([]Location, error) {
+	scripts, ok := m[owner]
+	if !ok {
+		return nil, fmt.Errorf("no script from a file for %s", owner)
+	}
+	found := []Location{}
+	seen := map[Location]bool{}
+	for _, ranges := range scripts {
+		for _, r := range ranges {
+			if r.Start <= line && line <= r.End {
+				l := Location{File: r.File, Line: r.Line + line - r.Start}
+				if !seen[l] {
+					seen[l] = true
+					found = append(found, l)
+				}
+				break
+			}
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("line %v of %s's script did not come from a file", line, owner)
+	}
+	return found, nil
+}
+
+// ParseError pulls the script owner and line out of an error message printed
+// by TTS.
+func ParseError(msg string) (string, int, error) {
+	matches := ttsError.FindStringSubmatch(msg)
+	if matches == nil {
+		return "", 0, fmt.Errorf("<%s> does not look like a TTS script error", msg)
+	}
+	owner := matches[1]
+	if matches[2] != "" {
+		owner = Global
+	}
+	line, err := strconv.Atoi(matches[3])
+	if err != nil {
+		return "", 0, err
+	}
+	return owner, line, nil
+}
+
+// ParseLocation reads either a TTS error message, or an owner and line given
+// as separate arguments.
+func ParseLocation(args []string) (string, int, error) {
+	if len(args) == 2 {
+		if line, err := strconv.Atoi(args[1]); err == nil {
+			return args[0], line, nil
+		}
+	}
+	return ParseError(strings.Join(args, " "))
+}
+
+// Write saves the map as json.
+func (m Map) Write(filename string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent(<sourcemap>) : %v", err)
+	}
+	return ioutil.WriteFile(filename, b, 0644)
+}
+
+// Read loads a map saved by Write.
+func Read(filename string) (Map, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	m := Map{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal(%s) : %v", filename, err)
+	}
+	return m, nil
+}
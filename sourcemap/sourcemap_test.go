@@ -0,0 +1,64 @@
+package sourcemap
+
+import (
+	"ModCreator/file"
+	"ModCreator/ttsjson"
+	"reflect"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	for msg, want := range map[string]struct {
+		owner string
+		line  int
+	}{
+		"Error in Script (Board - 1a2b3c): chunk_1:(812,4-20): attempt to index a nil value": {"1a2b3c", 812},
+		"Error in Script (Global -1): chunk_1:(12,0-5): bad argument":                        {Global, 12},
+	} {
+		owner, line, err := ParseError(msg)
+		if err != nil {
+			t.Errorf("ParseError(%s) : %v", msg, err)
+			continue
+		}
+		if owner != want.owner || line != want.line {
+			t.Errorf("want %s:%v got %s:%v", want.owner, want.line, owner, line)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	script := "a\nb\n\nc\nd"
+	first := ttsjson.Convert(map[string]interface{}{"GUID": "abc123", "LuaScript": script}).(*ttsjson.Object)
+	// a card of the same deck, sharing the GUID.
+	second := ttsjson.Convert(map[string]interface{}{"GUID": "abc123", "LuaScript": "e"}).(*ttsjson.Object)
+	o := file.ScriptOrigins{
+		first: {
+			{File: "base.ttslua", Line: 1},
+			{File: "lib.ttslua", Line: 1},
+			{File: "lib.ttslua", Line: 2},
+			{File: "base.ttslua", Line: 3},
+			{File: "base.ttslua", Line: 4},
+		},
+		second: {{File: "other.ttslua", Line: 7}},
+	}
+	mod := ttsjson.NewObject()
+	mod.Set("ObjectStates", []interface{}{first, second})
+	m := Build(mod, o, "src")
+	if len(m["abc123"]) != 2 || len(m["abc123"][0]) != 3 {
+		t.Errorf("want 3 ranges, then 1, got %v", m["abc123"])
+	}
+	found, err := m.Locate("abc123", 5)
+	if err != nil {
+		t.Fatalf("Locate() : %v", err)
+	}
+	if want := []Location{{File: "src/base.ttslua", Line: 4}}; !reflect.DeepEqual(found, want) {
+		t.Errorf("want %v got %v", want, found)
+	}
+	found, err = m.Locate("abc123", 1)
+	if err != nil {
+		t.Fatalf("Locate() : %v", err)
+	}
+	if want := []Location{{File: "src/base.ttslua", Line: 1}, {File: "src/other.ttslua", Line: 7}}; !reflect.DeepEqual(found, want) {
+		t.Errorf("want %v got %v", want, found)
+	}
+}
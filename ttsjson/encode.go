@@ -0,0 +1,175 @@
+package ttsjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+const indent = "  "
+
+// Marshal encodes v as TTS writes a save file: two space indentation, empty
+// objects and arrays on one line, and a trailing newline. Number literals read
+// by Unmarshal are written unchanged.
+func Marshal(v interface{}) ([]byte, error) {
+	e := &encoder{}
+	if err := e.encode(v, 0); err != nil {
+		return nil, err
+	}
+	e.buf.WriteByte('\n')
+	return e.buf.Bytes(), nil
+}
+
+// MarshalCompact encodes v without any whitespace, escaping strings as
+// Marshal does.
+func MarshalCompact(v interface{}) ([]byte, error) {
+	e := &encoder{compact: true}
+	if err := e.encode(v, 0); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	buf     bytes.Buffer
+	compact bool
+}
+
+func (e *encoder) encode(v interface{}, depth int) error {
+	buf := &e.buf
+	switch val := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(val))
+	case string:
+		writeString(buf, val)
+	case json.Number:
+		buf.WriteString(val.String())
+	case float64:
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return fmt.Errorf("unsupported number %v", val)
+		}
+		b, _ := json.Marshal(val)
+		buf.Write(b)
+	case int:
+		buf.WriteString(strconv.Itoa(val))
+	case int64:
+		buf.WriteString(strconv.FormatInt(val, 10))
+	case *Object:
+		if val.Len() == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteByte('{')
+		for i, k := range val.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			e.newline(depth + 1)
+			writeString(buf, k)
+			buf.WriteByte(':')
+			if !e.compact {
+				buf.WriteByte(' ')
+			}
+			if err := e.encode(val.values[k], depth+1); err != nil {
+				return err
+			}
+		}
+		e.newline(depth)
+		buf.WriteByte('}')
+	case map[string]interface{}:
+		return e.encode(Convert(val), depth)
+	case []interface{}:
+		if len(val) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteByte('[')
+		for i, elem := range val {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			e.newline(depth + 1)
+			if err := e.encode(elem, depth+1); err != nil {
+				return err
+			}
+		}
+		e.newline(depth)
+		buf.WriteByte(']')
+	default:
+		// anything else goes through encoding/json first.
+		b, err := json.Marshal(val)
+		if err != nil {
+			return err
+		}
+		decoded, err := Unmarshal(b)
+		if err != nil {
+			return err
+		}
+		return e.encode(decoded, depth)
+	}
+	return nil
+}
+
+func (e *encoder) newline(depth int) {
+	if e.compact {
+		return
+	}
+	e.buf.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		e.buf.WriteString(indent)
+	}
+}
+
+const hex = "0123456789abcdef"
+
+// writeString quotes s like Json.NET does by default: only quotes,
+// backslashes, control characters and the unicode line separators are
+// escaped. Html characters and other non-ascii text are left alone.
+func writeString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch c {
+			case '"':
+				buf.WriteString(`\"`)
+			case '\\':
+				buf.WriteString(`\\`)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\t':
+				buf.WriteString(`\t`)
+			case '\b':
+				buf.WriteString(`\b`)
+			case '\f':
+				buf.WriteString(`\f`)
+			default:
+				if c < 0x20 {
+					buf.WriteString(`\u00`)
+					buf.WriteByte(hex[c>>4])
+					buf.WriteByte(hex[c&0xf])
+				} else {
+					buf.WriteByte(c)
+				}
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch r {
+		case '\u0085', '\u2028', '\u2029':
+			fmt.Fprintf(buf, `\u%04x`, r)
+		default:
+			buf.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	buf.WriteByte('"')
+}
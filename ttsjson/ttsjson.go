@@ -0,0 +1,250 @@
+// Package ttsjson reads and writes json the way Tabletop Simulator does. Keys
+// stay in the order they were read, numbers keep their exact literals, and
+// output is indented and escaped like a TTS save file, so that an unchanged
+// document is written back byte for byte.
+package ttsjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Object is a json object which remembers the order of its keys.
+type Object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewObject makes an empty Object. The zero Object is also ready to use.
+func NewObject() *Object {
+	return &Object{values: map[string]interface{}{}}
+}
+
+// Get returns the value at k.
+func (o *Object) Get(k string) (interface{}, bool) {
+	v, ok := o.values[k]
+	return v, ok
+}
+
+// String returns the value at k if it is a string.
+func (o *Object) String(k string) (string, bool) {
+	s, ok := o.values[k].(string)
+	return s, ok
+}
+
+// Object returns the value at k if it is a json object.
+func (o *Object) Object(k string) (*Object, bool) {
+	sub, ok := o.values[k].(*Object)
+	return sub, ok
+}
+
+// Array returns the value at k if it is a json array.
+func (o *Object) Array(k string) ([]interface{}, bool) {
+	arr, ok := o.values[k].([]interface{})
+	return arr, ok
+}
+
+// Set changes the value at k. A new key is added after all the others.
+func (o *Object) Set(k string, v interface{}) {
+	if o.values == nil {
+		o.values = map[string]interface{}{}
+	}
+	if _, ok := o.values[k]; !ok {
+		o.keys = append(o.keys, k)
+	}
+	o.values[k] = v
+}
+
+// InsertAfter sets k, placing it right after the key after. Without after,
+// it is the same as Set.
+func (o *Object) InsertAfter(after, k string, v interface{}) {
+	o.Delete(k)
+	o.Set(k, v)
+	for i, key := range o.keys[:len(o.keys)-1] {
+		if key == after {
+			copy(o.keys[i+2:], o.keys[i+1:])
+			o.keys[i+1] = k
+			return
+		}
+	}
+}
+
+// Delete removes k.
+func (o *Object) Delete(k string) {
+	if _, ok := o.values[k]; !ok {
+		return
+	}
+	delete(o.values, k)
+	for i, key := range o.keys {
+		if key == k {
+			o.keys = append(o.keys[:i:i], o.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// Rename moves the value at from to the key to, in from's place. Any value
+// already at to is dropped. It reports whether from was found.
+func (o *Object) Rename(from, to string) bool {
+	v, ok := o.values[from]
+	if !ok {
+		return false
+	}
+	if from == to {
+		return true
+	}
+	o.Delete(to)
+	delete(o.values, from)
+	o.values[to] = v
+	for i, key := range o.keys {
+		if key == from {
+			o.keys[i] = to
+		}
+	}
+	return true
+}
+
+// Keys lists the keys in order.
+func (o *Object) Keys() []string {
+	return append([]string{}, o.keys...)
+}
+
+// SortKeys reorders the keys. Keys which less doesn't order keep their
+// relative order.
+func (o *Object) SortKeys(less func(a, b string) bool) {
+	sort.SliceStable(o.keys, func(i, k int) bool {
+		return less(o.keys[i], o.keys[k])
+	})
+}
+
+// Len is the number of keys.
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+// Unmarshal decodes a json document. Objects become *Object, arrays
+// []interface{} and numbers json.Number.
+func Unmarshal(b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	v, err := decode(d)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err == nil {
+		return nil, fmt.Errorf("unexpected data after the json value")
+	}
+	return v, nil
+}
+
+// UnmarshalObject decodes a json document holding an object.
+func UnmarshalObject(b []byte) (*Object, error) {
+	v, err := Unmarshal(b)
+	if err != nil {
+		return nil, err
+	}
+	o, ok := v.(*Object)
+	if !ok {
+		return nil, fmt.Errorf("expected a json object, got %T", v)
+	}
+	return o, nil
+}
+
+func decode(d *json.Decoder) (interface{}, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := t.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			o := NewObject()
+			for d.More() {
+				kt, err := d.Token()
+				if err != nil {
+					return nil, err
+				}
+				k, ok := kt.(string)
+				if !ok {
+					return nil, fmt.Errorf("expected an object key, got %v", kt)
+				}
+				v, err := decode(d)
+				if err != nil {
+					return nil, err
+				}
+				o.Set(k, v)
+			}
+			_, err := d.Token()
+			return o, err
+		case '[':
+			arr := []interface{}{}
+			for d.More() {
+				v, err := decode(d)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+			_, err := d.Token()
+			return arr, err
+		}
+		return nil, fmt.Errorf("unexpected %v", tok)
+	}
+	return t, nil
+}
+
+// Convert turns maps into Objects with sorted keys, throughout v.
+func Convert(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		o := NewObject()
+		for _, k := range sortedKeys(val) {
+			o.Set(k, Convert(val[k]))
+		}
+		return o
+	case []map[string]interface{}:
+		arr := make([]interface{}, 0, len(val))
+		for _, e := range val {
+			arr = append(arr, Convert(e))
+		}
+		return arr
+	case []interface{}:
+		arr := make([]interface{}, 0, len(val))
+		for _, e := range val {
+			arr = append(arr, Convert(e))
+		}
+		return arr
+	}
+	return v
+}
+
+// Plain turns Objects back into maps, throughout v.
+func Plain(v interface{}) interface{} {
+	switch val := v.(type) {
+	case *Object:
+		m := make(map[string]interface{}, len(val.keys))
+		for _, k := range val.keys {
+			m[k] = Plain(val.values[k])
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, 0, len(val))
+		for _, e := range val {
+			arr = append(arr, Plain(e))
+		}
+		return arr
+	}
+	return v
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,112 @@
+package ttsjson
+
+import (
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	doc := `{
+  "SaveName": "<Panel> & \"more\"",
+  "Gravity": 0.5,
+  "PlayArea": 1.0,
+  "Tiny": 6.36111E-14,
+  "Note": "line\r\nnext\ttab \u0001 ünïcode \u2028",
+  "Tags": [],
+  "Grid": {},
+  "ObjectStates": [
+    {
+      "GUID": "abc123",
+      "Name": "Card",
+      "Transform": {
+        "posX": -3.0
+      }
+    }
+  ]
+}
+`
+	v, err := Unmarshal([]byte(doc))
+	if err != nil {
+		t.Fatalf("Unmarshal() : %v", err)
+	}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal() : %v", err)
+	}
+	if string(b) != doc {
+		t.Errorf("want <%s> got <%s>", doc, b)
+	}
+}
+
+func TestObjectOrder(t *testing.T) {
+	o, err := UnmarshalObject([]byte(`{"c": 1, "a": 2, "b": 3}`))
+	if err != nil {
+		t.Fatalf("UnmarshalObject() : %v", err)
+	}
+	o.Rename("a", "a_path")
+	o.Set("d", 4)
+	o.Delete("c")
+	o.Set("b", 5)
+
+	want := "{\n  \"a_path\": 2,\n  \"b\": 5,\n  \"d\": 4\n}\n"
+	b, err := Marshal(o)
+	if err != nil {
+		t.Fatalf("Marshal() : %v", err)
+	}
+	if string(b) != want {
+		t.Errorf("want <%s> got <%s>", want, b)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	v := Convert(map[string]interface{}{
+		"b": []interface{}{map[string]interface{}{"y": true, "x": nil}},
+		"a": "s",
+	})
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal() : %v", err)
+	}
+	want := "{\n  \"a\": \"s\",\n  \"b\": [\n    {\n      \"x\": null,\n      \"y\": true\n    }\n  ]\n}\n"
+	if string(b) != want {
+		t.Errorf("want <%s> got <%s>", want, b)
+	}
+	plain := Plain(v).(map[string]interface{})
+	if plain["a"] != "s" {
+		t.Errorf("want a=s, got %v", plain)
+	}
+}
+
+func TestUnmarshalTrailingData(t *testing.T) {
+	if _, err := Unmarshal([]byte(`{} {}`)); err == nil {
+		t.Errorf("want an error for trailing data")
+	}
+}
+
+func TestEscapes(t *testing.T) {
+	b, err := Marshal("<a href=\"x\">&</a>\\\u2028\x7f\x1f")
+	if err != nil {
+		t.Fatalf("Marshal() : %v", err)
+	}
+	want := `"<a href=\"x\">&</a>\\\u2028` + "\x7f" + `\u001f"` + "\n"
+	if string(b) != want {
+		t.Errorf("want <%s> got <%s>", want, b)
+	}
+}
+
+func TestInsertAfter(t *testing.T) {
+	o := NewObject()
+	o.Set("a", 1)
+	o.Set("c", 3)
+	o.InsertAfter("a", "b", 2)
+	o.InsertAfter("missing", "d", 4)
+	want := []string{"a", "b", "c", "d"}
+	got := o.Keys()
+	if len(got) != len(want) {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("want %v got %v", want, got)
+		}
+	}
+}